@@ -3,12 +3,10 @@ package auth
 import (
 	"context"
 	"errors"
-	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"newsdrop.org/env"
 	"newsdrop.org/store/cache"
 )
 
@@ -18,168 +16,172 @@ var (
 )
 
 type Tokens struct {
-	Access   string
-	Refresh  string
-	JTIAcc   string
-	JTIRef   string
-	ExpAcc   time.Time
-	ExpRef   time.Time
-	UserID   string
-	Issuer   string
-	Audience string
+	Access    string
+	Refresh   string
+	JTIAcc    string
+	JTIRef    string
+	ExpAcc    time.Time
+	ExpRef    time.Time
+	UserID    string
+	SessionID string
+	Issuer    string
+	Audience  string
+}
+
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	TokenUseMFA     = "mfa"
+
+	MFAChallengeTTL = 5 * time.Minute
+
+	issuer   = "glimpze-app"
+	audience = "glimpze-client"
+)
+
+// tokenKind is how each use of our JWTs is told apart. They share the issuer
+// and the keys in the JWKS, so refresh and MFA tokens get an audience and
+// typ header of their own that no verifier expecting an access token would
+// accept.
+type tokenKind struct {
+	audience string
+	typ      string
+}
+
+var tokenKinds = map[string]tokenKind{
+	TokenUseAccess:  {audience: audience, typ: "at+jwt"},
+	TokenUseRefresh: {audience: "glimpze-refresh", typ: "refresh+jwt"},
+	TokenUseMFA:     {audience: "glimpze-mfa", typ: "mfa+jwt"},
 }
 
 type Claims struct {
-	Email  string `json:"email"`
-	UserID int64  `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	TokenUse  string `json:"token_use"`
 	jwt.RegisteredClaims
 }
 
-func IssueTokens(userID string) (*Tokens, error) {
+func (ks *KeySet) IssueTokens(userID, sessionID string) (*Tokens, error) {
 	now := time.Now().UTC()
 	t := &Tokens{
-		UserID:   userID,
-		JTIAcc:   uuid.NewString(),
-		JTIRef:   uuid.NewString(),
-		ExpAcc:   now.Add(24 * time.Hour),
-		ExpRef:   now.Add(7 * 24 * time.Hour),
-		Issuer:   "glimpze-app",
-		Audience: "glimpze-client",
+		UserID:    userID,
+		SessionID: sessionID,
+		JTIAcc:    uuid.NewString(),
+		JTIRef:    uuid.NewString(),
+		ExpAcc:    now.Add(24 * time.Hour),
+		ExpRef:    now.Add(7 * 24 * time.Hour),
+		Issuer:    issuer,
+		Audience:  audience,
 	}
 
-	acc := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Subject:   userID,
-		ID:        t.JTIAcc,
-		Issuer:    t.Issuer,
-		Audience:  jwt.ClaimStrings{t.Audience},
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(t.ExpAcc),
-	})
-
-	ref := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Subject:   userID,
-		ID:        t.JTIRef,
-		Issuer:    t.Issuer,
-		Audience:  jwt.ClaimStrings{t.Audience},
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(t.ExpRef),
-	})
-
 	var err error
-	t.Access, err = acc.SignedString([]byte(env.GetString("ACCESS_SECRET", "change-this")))
+	t.Access, err = ks.sign(TokenUseAccess, Claims{
+		SessionID: sessionID,
+		TokenUse:  TokenUseAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ID:        t.JTIAcc,
+			Issuer:    t.Issuer,
+			Audience:  jwt.ClaimStrings{t.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(t.ExpAcc),
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
-	t.Refresh, err = ref.SignedString([]byte(env.GetString("REFRESH_SECRET", "change-this")))
+
+	t.Refresh, err = ks.sign(TokenUseRefresh, Claims{
+		SessionID: sessionID,
+		TokenUse:  TokenUseRefresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ID:        t.JTIRef,
+			Issuer:    t.Issuer,
+			Audience:  jwt.ClaimStrings{tokenKinds[TokenUseRefresh].audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(t.ExpRef),
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
 	return t, nil
 }
 
-func Persist(ctx context.Context, v *cache.Storage, t *Tokens) error {
+// IssueMFAChallenge signs the short-lived token a password login hands back
+// when the account has two-factor authentication turned on. It carries no
+// access rights and is only accepted by the second login step.
+func (ks *KeySet) IssueMFAChallenge(userID string) (string, *Claims, error) {
+	now := time.Now().UTC()
+	claims := &Claims{
+		TokenUse: TokenUseMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ID:        uuid.NewString(),
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{tokenKinds[TokenUseMFA].audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+		},
+	}
+
+	token, err := ks.sign(TokenUseMFA, claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// Persist stores the token JTIs and points the session at the new pair.
+func Persist(ctx context.Context, v *cache.Storage, t *Tokens, s *cache.Session) error {
 	if err := v.Sessions.Set(ctx, "access:"+t.JTIAcc, t.UserID, t.ExpAcc); err != nil {
 		return err
 	}
 	if err := v.Sessions.Set(ctx, "refresh:"+t.JTIRef, t.UserID, t.ExpRef); err != nil {
 		return err
 	}
-	return nil
-}
 
-func SetAuthCookies(w http.ResponseWriter, t *Tokens) {
-	access_cookie := &http.Cookie{
-		Name:     "access_token",
-		Value:    t.Access,
-		MaxAge:   int(time.Until(t.ExpAcc).Seconds()),
-		Path:     "/",
-		Domain:   "",
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteDefaultMode,
-	}
-
-	refresh_cookie := &http.Cookie{
-		Name:     "refresh_token",
-		Value:    t.Refresh,
-		MaxAge:   int(time.Until(t.ExpRef).Seconds()),
-		Path:     "/",
-		Domain:   "",
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteDefaultMode,
-	}
+	s.AccessJTI = t.JTIAcc
+	s.RefreshJTI = t.JTIRef
+	s.Generation++
+	s.LastUsedAt = time.Now().UTC()
+	s.ExpiresAt = t.ExpRef
 
-	http.SetCookie(w, access_cookie)
-	http.SetCookie(w, refresh_cookie)
+	return v.Sessions.SaveSession(ctx, s)
 }
 
-func ClearAuthCookies(w http.ResponseWriter) {
-	access_cookie := &http.Cookie{
-		Name:     "access_token",
-		Value:    "",
-		MaxAge:   -1,
-		Path:     "/",
-		Domain:   "",
-		Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	}
-
-	refresh_cookie := &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		MaxAge:   -1,
-		Path:     "/",
-		Domain:   "",
-		Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	}
-
-	http.SetCookie(w, access_cookie)
-	http.SetCookie(w, refresh_cookie)
+func (ks *KeySet) ParseAccess(tokenStr string) (*Claims, error) {
+	return ks.parse(tokenStr, TokenUseAccess)
 }
 
-func ParseAccess(tokenStr string) (*jwt.RegisteredClaims, error) {
-	secret := env.GetString("ACCESS_SECRET", "change-this")
-	return parseWithSecret(tokenStr, secret)
+func (ks *KeySet) ParseRefresh(tokenStr string) (*Claims, error) {
+	return ks.parse(tokenStr, TokenUseRefresh)
 }
 
-func ParseRefresh(tokenStr string) (*jwt.RegisteredClaims, error) {
-	secret := env.GetString("REFRESH_SECRET", "change-this")
-	return parseWithSecret(tokenStr, secret)
+func (ks *KeySet) ParseMFAChallenge(tokenStr string) (*Claims, error) {
+	return ks.parse(tokenStr, TokenUseMFA)
 }
 
-func parseWithSecret(tokenStr, secret string) (*jwt.RegisteredClaims, error) {
-	if secret == "" {
-		return nil, errors.New("jwt secret not configured")
-	}
+func (ks *KeySet) parse(tokenStr, tokenUse string) (*Claims, error) {
+	kind := tokenKinds[tokenUse]
 
-	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(kind.audience),
+		jwt.WithExpirationRequired(),
+	)
 
-	token, err := parser.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
+	token, err := parser.ParseWithClaims(tokenStr, &Claims{}, ks.keyFunc)
 	if err != nil {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || !token.Valid {
+	typ, _ := token.Header["typ"].(string)
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || typ != kind.typ || claims.TokenUse != tokenUse {
 		return nil, ErrInvalidToken
 	}
 
 	return claims, nil
 }
-
-func MustCookie(r *http.Request, name string) (string, error) {
-	val, err := r.Cookie(name)
-	if err != nil {
-		return "", err
-	}
-	return val.Value, nil
-}
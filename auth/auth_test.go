@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestTokensOnlyParseAsTheirOwnKind(t *testing.T) {
+	ks, err := GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := ks.IssueTokens("1", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, _, err := ks.IssueMFAChallenge("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsers := map[string]func(string) (*Claims, error){
+		TokenUseAccess:  ks.ParseAccess,
+		TokenUseRefresh: ks.ParseRefresh,
+		TokenUseMFA:     ks.ParseMFAChallenge,
+	}
+	tokensByUse := map[string]string{
+		TokenUseAccess:  tokens.Access,
+		TokenUseRefresh: tokens.Refresh,
+		TokenUseMFA:     challenge,
+	}
+
+	for use, token := range tokensByUse {
+		for parserUse, parse := range parsers {
+			_, err := parse(token)
+			if parserUse == use && err != nil {
+				t.Errorf("%s token rejected by its own parser: %v", use, err)
+			}
+			if parserUse != use && err == nil {
+				t.Errorf("%s token accepted as %s", use, parserUse)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+
+	// The refresh token is only ever sent to the endpoints that rotate or
+	// revoke it.
+	refreshCookiePath = "/v1/auth"
+)
+
+// CookieConfig controls the attributes of every auth cookie.
+type CookieConfig struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// ParseSameSite maps "lax", "strict" and "none" to their http.SameSite mode.
+func ParseSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(mode) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite mode %q", mode)
+	}
+}
+
+func (c CookieConfig) cookie(name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+// SetAuthCookies stores the tokens in HttpOnly cookies along with a CSRF
+// token the client has to echo in the X-CSRF-Token header. The CSRF cookie
+// is readable from JavaScript and lives as long as the refresh token.
+func SetAuthCookies(w http.ResponseWriter, c CookieConfig, t *Tokens, csrfToken string) {
+	http.SetCookie(w, c.cookie(AccessTokenCookie, t.Access, "/", int(time.Until(t.ExpAcc).Seconds()), true))
+	http.SetCookie(w, c.cookie(RefreshTokenCookie, t.Refresh, refreshCookiePath, int(time.Until(t.ExpRef).Seconds()), true))
+	http.SetCookie(w, c.cookie(CSRFTokenCookie, csrfToken, "/", int(time.Until(t.ExpRef).Seconds()), false))
+}
+
+func ClearAuthCookies(w http.ResponseWriter, c CookieConfig) {
+	http.SetCookie(w, c.cookie(AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, c.cookie(RefreshTokenCookie, "", refreshCookiePath, -1, true))
+	http.SetCookie(w, c.cookie(CSRFTokenCookie, "", "/", -1, false))
+}
+
+func NewCSRFToken() (string, error) {
+	return randomString(32)
+}
+
+// VerifyCSRF checks the double-submitted token: the header must match the
+// cookie.
+func VerifyCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(CSRFTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+func MustCookie(r *http.Request, name string) (string, error) {
+	val, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return val.Value, nil
+}
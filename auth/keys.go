@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet holds the Ed25519 key tokens are signed with and every public key
+// tokens are still accepted from. Rotating means adding a new key, pointing
+// the signing kid at it and keeping the old public key around until the
+// tokens it signed have expired.
+type KeySet struct {
+	signingKID string
+	signingKey ed25519.PrivateKey
+	verifyKeys map[string]ed25519.PublicKey
+}
+
+// LoadKeySet reads PEM encoded keys from dir. <kid>.pem files hold PKCS#8
+// private keys, <kid>.pub.pem files hold PKIX public keys of retired keys
+// that may still verify tokens. signingKID must name one of the private keys.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{
+		signingKID: signingKID,
+		verifyKeys: make(map[string]ed25519.PublicKey),
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM data", name)
+		}
+
+		if kid, ok := strings.CutSuffix(name, ".pub.pem"); ok {
+			pub, err := parsePublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			ks.verifyKeys[kid] = pub
+			continue
+		}
+
+		kid := strings.TrimSuffix(name, ".pem")
+		priv, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		ks.verifyKeys[kid] = priv.Public().(ed25519.PublicKey)
+		if kid == signingKID {
+			ks.signingKey = priv
+		}
+	}
+
+	if ks.signingKey == nil {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingKID, dir)
+	}
+
+	return ks, nil
+}
+
+// GenerateKeySet creates a throwaway key pair. Tokens signed with it stop
+// verifying when the process exits, so it is only fit for development.
+func GenerateKeySet() (*KeySet, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	kid := "dev-" + base64.RawURLEncoding.EncodeToString(pub[:6])
+
+	return &KeySet{
+		signingKID: kid,
+		signingKey: priv,
+		verifyKeys: map[string]ed25519.PublicKey{kid: pub},
+	}, nil
+}
+
+func parsePrivateKey(der []byte) (ed25519.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return priv, nil
+}
+
+func parsePublicKey(der []byte) (ed25519.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 public key")
+	}
+	return pub, nil
+}
+
+func (ks *KeySet) sign(tokenUse string, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = ks.signingKID
+	token.Header["typ"] = tokenKinds[tokenUse].typ
+	return token.SignedString(ks.signingKey)
+}
+
+func (ks *KeySet) keyFunc(t *jwt.Token) (any, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	pub, ok := ks.verifyKeys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return pub, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every verification key in RFC 8037 OKP form.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(ks.verifyKeys))}
+
+	for kid, pub := range ks.verifyKeys {
+		jwks.Keys = append(jwks.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+			Kid: kid,
+			Use: "sig",
+			Alg: jwt.SigningMethodEdDSA.Alg(),
+		})
+	}
+
+	return jwks
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey generates a key pair and stores it in dir the way LoadKeySet
+// expects: as <kid>.pem when private, as <kid>.pub.pem when retired.
+func writeKey(t *testing.T, dir, kid string, private bool) ed25519.PublicKey {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, block := kid+".pub.pem", &pem.Block{Type: "PUBLIC KEY"}
+	if private {
+		name, block.Type = kid+".pem", "PRIVATE KEY"
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(priv)
+	} else {
+		block.Bytes, err = x509.MarshalPKIXPublicKey(pub)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+// retireKey replaces the private key file for kid with its public half.
+func retireKey(t *testing.T, dir, kid string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, kid+".pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	priv, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pub.pem"), pubPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, kid+".pem")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func issueAccess(t *testing.T, ks *KeySet) string {
+	t.Helper()
+
+	tokens, err := ks.IssueTokens("1", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.Access
+}
+
+func tokenKID(t *testing.T, tokenStr string) string {
+	t.Helper()
+
+	token, _, err := jwt.NewParser().ParseUnverified(tokenStr, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	want := map[string]ed25519.PublicKey{
+		"current": writeKey(t, dir, "current", true),
+		"next":    writeKey(t, dir, "next", true),
+		"old":     writeKey(t, dir, "old", false),
+	}
+	// Anything that isn't a .pem file is left alone.
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("keys"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "archive.pem"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := LoadKeySet(dir, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid := tokenKID(t, issueAccess(t, ks)); kid != "current" {
+		t.Errorf("signed with kid %q, want current", kid)
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != len(want) {
+		t.Fatalf("JWKS has %d keys, want %d", len(jwks.Keys), len(want))
+	}
+	for _, jwk := range jwks.Keys {
+		pub, ok := want[jwk.Kid]
+		if !ok {
+			t.Errorf("unexpected kid %q in JWKS", jwk.Kid)
+			continue
+		}
+		if jwk.X != base64.RawURLEncoding.EncodeToString(pub) {
+			t.Errorf("%s: x = %q does not match the key on disk", jwk.Kid, jwk.X)
+		}
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" || jwk.Use != "sig" {
+			t.Errorf("%s: jwk = %+v", jwk.Kid, jwk)
+		}
+	}
+}
+
+func TestLoadKeySetRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, dir string)
+		signingKID string
+	}{
+		{
+			name:       "missing signing key",
+			setup:      func(t *testing.T, dir string) { writeKey(t, dir, "current", true) },
+			signingKID: "other",
+		},
+		{
+			name:       "retired signing key",
+			setup:      func(t *testing.T, dir string) { writeKey(t, dir, "old", false) },
+			signingKID: "old",
+		},
+		{
+			name: "not PEM",
+			setup: func(t *testing.T, dir string) {
+				writeKey(t, dir, "current", true)
+				if err := os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			signingKID: "current",
+		},
+		{
+			name: "public key under a private name",
+			setup: func(t *testing.T, dir string) {
+				writeKey(t, dir, "current", false)
+				if err := os.Rename(filepath.Join(dir, "current.pub.pem"), filepath.Join(dir, "current.pem")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			signingKID: "current",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+
+			if _, err := LoadKeySet(dir, tt.signingKID); err == nil {
+				t.Fatal("LoadKeySet succeeded")
+			}
+		})
+	}
+}
+
+func TestKeySetRejectsUnknownKey(t *testing.T) {
+	ks, err := GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ks.ParseAccess(issueAccess(t, other)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token from another key set: err = %v, want ErrUnknownKey", err)
+	}
+
+	// A known kid doesn't help a token that was signed by a different key.
+	forged := *other
+	forged.signingKID = ks.signingKID
+	if _, err := ks.ParseAccess(issueAccess(t, &forged)); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("token under a borrowed kid: err = %v, want ErrTokenSignatureInvalid", err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", true)
+
+	before, err := LoadKeySet(dir, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken := issueAccess(t, before)
+
+	// Rotate: sign with a new key and keep only the public half of the old
+	// one, so tokens it signed verify until they expire.
+	writeKey(t, dir, "k2", true)
+	retireKey(t, dir, "k1")
+
+	after, err := LoadKeySet(dir, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken := issueAccess(t, after)
+
+	if kid := tokenKID(t, newToken); kid != "k2" {
+		t.Errorf("signed with kid %q after rotation, want k2", kid)
+	}
+	if _, err := after.ParseAccess(oldToken); err != nil {
+		t.Errorf("token from the retired key: %v", err)
+	}
+	if _, err := after.ParseAccess(newToken); err != nil {
+		t.Errorf("token from the new key: %v", err)
+	}
+	if _, err := before.ParseAccess(newToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old key set verifying a new token: err = %v, want ErrUnknownKey", err)
+	}
+
+	// Once the retired key is dropped, its tokens stop verifying.
+	if err := os.Remove(filepath.Join(dir, "k1.pub.pem")); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := LoadKeySet(dir, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pruned.ParseAccess(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token from a dropped key: err = %v, want ErrUnknownKey", err)
+	}
+	if len(pruned.JWKS().Keys) != 1 {
+		t.Errorf("JWKS after pruning = %+v, want only k2", pruned.JWKS().Keys)
+	}
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is an OpenID provider that answers every code with the ID token in
+// idToken, signed by key under kid.
+type mockIdP struct {
+	server *httptest.Server
+	key    ed25519.PrivateKey
+	kid    string
+
+	idToken func(issuer string) jwt.Claims
+	// lastForm is the token request of the last exchange.
+	lastForm url.Values
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{key: key, kid: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"use": "sig",
+				"kid": "key-1",
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		idp.lastForm = r.PostForm
+
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, idp.idToken(idp.server.URL))
+		token.Header["kid"] = idp.kid
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     signed,
+		})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example/callback",
+	})
+}
+
+func validClaims(issuer string) *IDTokenClaims {
+	now := time.Now()
+	return &IDTokenClaims{
+		Email:         "ada@example.com",
+		EmailVerified: true,
+		Name:          "Ada",
+		Nonce:         "nonce",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{"client"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+
+	raw, err := idp.provider().AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.server.URL+"/authorize" {
+		t.Errorf("endpoint = %q", got)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "https://app.example/callback",
+		"scope":                 "openid email profile",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+	}
+	q := u.Query()
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.idToken = func(issuer string) jwt.Claims { return validClaims(issuer) }
+
+	claims, err := idp.provider().Exchange(context.Background(), "code", "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "user-1" || claims.Email != "ada@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	form := idp.lastForm
+	if form.Get("code") != "code" || form.Get("code_verifier") != "verifier" || form.Get("client_secret") != "secret" {
+		t.Errorf("token request = %v", form)
+	}
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		kid     string
+		idToken func(issuer string) jwt.Claims
+		nonce   string
+		wantErr error
+	}{
+		{
+			name:    "nonce mismatch",
+			idToken: func(issuer string) jwt.Claims { return validClaims(issuer) },
+			nonce:   "other",
+			wantErr: ErrOIDCNonceMismatch,
+		},
+		{
+			name: "wrong audience",
+			idToken: func(issuer string) jwt.Claims {
+				c := validClaims(issuer)
+				c.Audience = jwt.ClaimStrings{"someone-else"}
+				return c
+			},
+			wantErr: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name: "wrong issuer",
+			idToken: func(issuer string) jwt.Claims {
+				return validClaims("https://evil.example")
+			},
+			wantErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name: "expired",
+			idToken: func(issuer string) jwt.Claims {
+				c := validClaims(issuer)
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				return c
+			},
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:    "unknown key",
+			kid:     "key-2",
+			idToken: func(issuer string) jwt.Claims { return validClaims(issuer) },
+			wantErr: ErrUnknownKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.idToken = tt.idToken
+			if tt.kid != "" {
+				idp.kid = tt.kid
+			}
+
+			nonce := tt.nonce
+			if nonce == "" {
+				nonce = "nonce"
+			}
+
+			_, err := idp.provider().Exchange(context.Background(), "code", "verifier", nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
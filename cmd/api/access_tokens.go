@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"newsdrop.org/store"
+)
+
+const accessTokenCtx contextKey = "access_token"
+
+var ErrAccessTokenNotAllowed = errors.New("personal access tokens can't be used here")
+
+func (app *application) authenticateAccessToken(ctx context.Context, plaintext string) (*store.User, *store.AccessToken, error) {
+	token, err := app.store.AccessTokens.GetByPlaintext(ctx, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := app.store.Users.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, token, nil
+}
+
+func getAccessTokenFromContext(r *http.Request) *store.AccessToken {
+	token, _ := r.Context().Value(accessTokenCtx).(*store.AccessToken)
+	return token
+}
+
+// requireScope lets requests authenticated with a personal access token
+// through only if the token carries scope. Session logins have every scope.
+func (app *application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := getAccessTokenFromContext(r)
+		if token != nil && !token.HasScope(scope) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionOnly keeps personal access tokens away from account management.
+func (app *application) sessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getAccessTokenFromContext(r) != nil {
+			app.unauthorizedErrorResponse(w, r, ErrAccessTokenNotAllowed)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type CreateAccessTokenPayload struct {
+	Name          string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresInDays *int     `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+func (app *application) createAccessToken(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAccessTokenPayload
+
+	user := getUserFromContext(r)
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	for _, scope := range payload.Scopes {
+		if !slices.Contains(store.AccessTokenScopes, scope) {
+			app.badRequestResponse(w, r, fmt.Errorf("unknown scope %q", scope))
+			return
+		}
+	}
+	slices.Sort(payload.Scopes)
+	scopes := slices.Compact(payload.Scopes)
+
+	var expiresAt *time.Time
+	if payload.ExpiresInDays != nil {
+		exp := time.Now().Add(time.Duration(*payload.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &exp
+	}
+
+	token, err := app.store.AccessTokens.Create(r.Context(), user.ID, payload.Name, scopes, expiresAt)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message":      "store this token now, it won't be shown again",
+		"access_token": token,
+	})
+}
+
+func (app *application) listAccessTokens(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	tokens, err := app.store.AccessTokens.List(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":       "success",
+		"access_tokens": tokens,
+		"scopes":        store.AccessTokenScopes,
+	})
+}
+
+func (app *application) revokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	tokenID, err := strconv.ParseInt(r.PathValue("tokenID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.AccessTokens.Delete(r.Context(), tokenID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
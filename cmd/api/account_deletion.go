@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"newsdrop.org/mailer"
+	"newsdrop.org/store"
+)
+
+var (
+	ErrDeletionScheduled    = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+	ErrDeletionPending      = errors.New("account is scheduled for deletion, cancel the deletion to make changes")
+)
+
+const (
+	// deletionGracePeriod is how long a user has to change their mind
+	// before the account is gone for good.
+	deletionGracePeriod = 30 * 24 * time.Hour
+	purgeInterval       = time.Hour
+	purgeBatchSize      = 100
+)
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+func (app *application) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	var payload DeleteAccountPayload
+
+	user := getUserFromContext(r)
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	deleteOn := time.Now().Add(deletionGracePeriod)
+
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Users.ScheduleDeletion(r.Context(), user.ID, deleteOn); err != nil {
+			return err
+		}
+		return s.AccessTokens.DeleteByUser(r.Context(), user.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, ErrDeletionScheduled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Cancelling takes a session, so every device is signed out to make
+	// sure whoever cancels has to sign back in first.
+	if err := app.cache.Sessions.DeleteByUser(r.Context(), strconv.FormatInt(user.ID, 10)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.clearAuthCookies(w)
+
+	app.logSecurityEvent(r, "account_deletion_scheduled", "user_id", user.ID, "delete_on", deleteOn)
+
+	app.background(func() {
+		data := map[string]any{
+			"Username":   user.Name,
+			"DeleteOn":   deleteOn.Format("January 2, 2006"),
+			"AccountURL": fmt.Sprintf("%s/account", app.config.frontendURL),
+		}
+		if err := app.mailer.SendAPI(mailer.AccountDeletionTemplate, user.Name, user.Email, data, app.config.env != "prod"); err != nil {
+			app.logger.Error("error sending account deletion email", "user_id", user.ID, "error", err)
+		}
+	})
+
+	app.jsonResponse(w, http.StatusAccepted, envelope{
+		"message":   "account scheduled for deletion",
+		"delete_on": deleteOn,
+	})
+}
+
+func (app *application) cancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if err := app.store.Users.CancelDeletion(r.Context(), user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, ErrDeletionNotScheduled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "account deletion cancelled",
+	})
+}
+
+// runPurger removes expired exports, empties old trash and deletes accounts
+// whose grace period is over, until ctx is cancelled.
+func (app *application) runPurger(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeExports(ctx)
+		app.purgeTrash(ctx)
+		app.purgeAccounts(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) purgeExports(ctx context.Context) {
+	exports, err := app.store.Exports.ListExpired(ctx, purgeBatchSize)
+	if err != nil {
+		app.logger.Error("error listing expired exports", "error", err)
+		return
+	}
+
+	for _, export := range exports {
+		if err := app.deleteExport(ctx, export); err != nil {
+			app.logger.Error("error deleting export", "export_id", export.ID, "error", err)
+		}
+	}
+}
+
+func (app *application) deleteExport(ctx context.Context, export *store.Export) error {
+	if export.ObjectKey != nil {
+		if err := app.storage.Delete(ctx, *export.ObjectKey); err != nil {
+			return err
+		}
+	}
+	return app.store.Exports.Delete(ctx, export.ID)
+}
+
+func (app *application) purgeAccounts(ctx context.Context) {
+	userIDs, err := app.store.Users.ListDueForDeletion(ctx, purgeBatchSize)
+	if err != nil {
+		app.logger.Error("error listing accounts due for deletion", "error", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		if err := app.purgeAccount(ctx, userID); err != nil {
+			app.logger.Error("error deleting account", "user_id", userID, "error", err)
+			continue
+		}
+		app.logger.Info("account deleted", "user_id", userID)
+	}
+}
+
+// purgeAccount removes the user's objects before the user, since the rows
+// that name them are gone once the delete cascades. A failure leaves the user
+// in place for the next run to retry.
+func (app *application) purgeAccount(ctx context.Context, userID int64) error {
+	trashed, err := app.store.Posts.ListDeleted(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range trashed {
+		if err := app.purgePost(ctx, post.ID); err != nil {
+			return err
+		}
+	}
+
+	files, err := app.store.PostFiles.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := app.storage.Delete(ctx, file.FileID.String()+file.FileExtension); err != nil {
+			return err
+		}
+	}
+
+	exports, err := app.store.Exports.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if err := app.deleteExport(ctx, export); err != nil {
+			return err
+		}
+	}
+
+	if err := app.cache.Sessions.DeleteByUser(ctx, strconv.FormatInt(userID, 10)); err != nil {
+		return err
+	}
+
+	return app.store.Users.Delete(ctx, userID)
+}
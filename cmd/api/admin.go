@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"newsdrop.org/store"
+)
+
+var (
+	ErrAccountSuspended = errors.New("account suspended")
+	ErrAccountBanned    = errors.New("account banned")
+	ErrSelfModeration   = errors.New("you can't change your own role or suspend yourself")
+	ErrExpiryInPast     = errors.New("expires_at must be in the future")
+	ErrNotSuspended     = errors.New("user is not suspended or banned")
+)
+
+const adminUsersPageSize = 50
+
+// activeSuspension returns the user's current suspension or ban, or nil.
+func (app *application) activeSuspension(ctx context.Context, user *store.User) (*store.Suspension, error) {
+	suspension, err := app.store.Suspensions.GetActive(ctx, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return suspension, err
+}
+
+// rejectSuspended answers the request and returns true if the user is
+// suspended or banned.
+func (app *application) rejectSuspended(w http.ResponseWriter, r *http.Request, user *store.User) bool {
+	suspension, err := app.activeSuspension(r.Context(), user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return true
+	}
+
+	if suspension != nil {
+		app.suspendedResponse(w, r, suspension)
+		return true
+	}
+
+	return false
+}
+
+// targetUser loads the user named by {userID} and makes sure it isn't the
+// admin acting on themselves or someone whose role can do more than theirs.
+func (app *application) targetUser(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	userID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	if userID == getUserFromContext(r).ID {
+		app.badRequestResponse(w, r, ErrSelfModeration)
+		return nil, false
+	}
+
+	user, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	covers, err := app.store.Roles.Covers(r.Context(), getUserFromContext(r).Role.ID, user.Role.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	if !covers {
+		app.logSecurityEvent(r, "moderation_outranked", "target_user_id", user.ID)
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+
+	return user, true
+}
+
+type ListUsersQuery struct {
+	Role   string `validate:"max=255"`
+	Status string `validate:"omitempty,oneof=active suspended banned"`
+	Q      string `validate:"max=255"`
+	Page   int64  `validate:"min=1"`
+}
+
+func (app *application) listUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	query := ListUsersQuery{
+		Role:   q.Get("role"),
+		Status: q.Get("status"),
+		Q:      q.Get("q"),
+		Page:   1,
+	}
+
+	if pageStr := q.Get("page"); pageStr != "" {
+		page, err := strconv.ParseInt(pageStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.Page = page
+	}
+
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	filter := store.UserFilter{
+		Role:   query.Role,
+		Status: query.Status,
+		Query:  query.Q,
+	}
+
+	if activatedStr := q.Get("activated"); activatedStr != "" {
+		activated, err := strconv.ParseBool(activatedStr)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		filter.Activated = &activated
+	}
+
+	total, users, err := app.store.Users.List(r.Context(), filter, adminUsersPageSize, (query.Page-1)*adminUsersPageSize)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "success",
+		"page":    query.Page,
+		"total":   total,
+		"users":   users,
+	})
+}
+
+type SuspendUserPayload struct {
+	Reason    string    `json:"reason" validate:"required,max=500"`
+	ExpiresAt time.Time `json:"expires_at" validate:"required"`
+}
+
+func (app *application) suspendUser(w http.ResponseWriter, r *http.Request) {
+	var payload SuspendUserPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !payload.ExpiresAt.After(time.Now()) {
+		app.badRequestResponse(w, r, ErrExpiryInPast)
+		return
+	}
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.suspend(w, r, user, payload.Reason, &payload.ExpiresAt)
+}
+
+type BanUserPayload struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+func (app *application) banUser(w http.ResponseWriter, r *http.Request) {
+	var payload BanUserPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.suspend(w, r, user, payload.Reason, nil)
+}
+
+// suspend records the suspension, or a ban when expiresAt is nil, and signs
+// the user out everywhere, access tokens included.
+func (app *application) suspend(w http.ResponseWriter, r *http.Request, user *store.User, reason string, expiresAt *time.Time) {
+	admin := getUserFromContext(r)
+
+	previous, err := app.activeSuspension(r.Context(), user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	suspension := &store.Suspension{
+		UserID:      user.ID,
+		ModeratorID: &admin.ID,
+		Reason:      reason,
+		ExpiresAt:   expiresAt,
+	}
+
+	event, message := "user_suspended", "user suspended"
+	if suspension.Permanent() {
+		event, message = "user_banned", "user banned"
+	}
+
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Suspensions.Create(r.Context(), suspension); err != nil {
+			return err
+		}
+		if err := s.AccessTokens.DeleteByUser(r.Context(), user.ID); err != nil {
+			return err
+		}
+		return app.audit(s, r, event, "user", user.ID, previous, suspension)
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.cache.Sessions.DeleteByUser(r.Context(), strconv.FormatInt(user.ID, 10)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message":    message,
+		"suspension": suspension,
+	})
+}
+
+func (app *application) liftSuspension(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	suspension, err := app.activeSuspension(r.Context(), user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Suspensions.Lift(r.Context(), user.ID, getUserFromContext(r).ID); err != nil {
+			return err
+		}
+		return app.audit(s, r, "user_suspension_lifted", "user", user.ID, suspension, nil)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, ErrNotSuspended)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
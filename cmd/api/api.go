@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"sync"
@@ -16,7 +17,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"newsdrop.org/env"
+	"newsdrop.org/auth"
 	"newsdrop.org/mailer"
 	"newsdrop.org/storage"
 	"newsdrop.org/store"
@@ -29,20 +30,34 @@ type application struct {
 	logger      *slog.Logger
 	db          *pgxpool.Pool
 	cache       cache.Storage
-	storage     *storage.R2Client
+	storage     storage.Storage
 	defaultRole *store.Role
 	mailer      mailer.Client
-	wg          sync.WaitGroup
+	jwtKeys     *auth.KeySet
+	// oidcProviders are keyed by the name used in /auth/oidc/{provider}.
+	oidcProviders map[string]*auth.OIDCProvider
+	wg            sync.WaitGroup
 }
 
 type config struct {
 	addr         string
 	env          string
+	frontendURL  string
 	dbConfig     dbConfig
 	valkeyCfg    valkeyCfg
+	storageCfg   storageCfg
 	r2Cfg        r2Cfg
 	rateLimitCfg rateLimitCfg
 	mailCfg      mailCfg
+	jwtCfg       jwtCfg
+	oidcCfg      oidcCfg
+	authCfg      authCfg
+	// trashRetention is how long deleted posts and comments can be
+	// restored before they are purged.
+	trashRetention time.Duration
+	// trustedProxies are the only peers whose X-Forwarded-For and
+	// X-Real-IP headers are believed.
+	trustedProxies []netip.Prefix
 }
 
 type dbConfig struct {
@@ -58,6 +73,13 @@ type valkeyCfg struct {
 	db      int
 }
 
+type storageCfg struct {
+	backend       string
+	localDir      string
+	publicURL     string
+	signingSecret string
+}
+
 type r2Cfg struct {
 	bucketName      string
 	accountID       string
@@ -70,6 +92,22 @@ type rateLimitCfg struct {
 	windowLength time.Duration
 }
 
+type jwtCfg struct {
+	keysDir    string
+	signingKID string
+}
+
+type authCfg struct {
+	// mode is "bearer" to return tokens in response bodies or "cookie" to
+	// keep them in HttpOnly cookies guarded by CSRF tokens.
+	mode   string
+	cookie auth.CookieConfig
+}
+
+type oidcCfg struct {
+	providers []auth.OIDCConfig
+}
+
 type mailCfg struct {
 	apiKey    string
 	fromEmail string
@@ -78,11 +116,11 @@ type mailCfg struct {
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.realIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{env.GetString("FRONTEND_URL", "http://localhost:5173")},
+		AllowedOrigins:   []string{app.config.frontendURL},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Set-Cookie"},
@@ -97,60 +135,149 @@ func (app *application) mount() http.Handler {
 		})),
 	)
 	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(app.csrfMiddleware)
+
+	r.Get("/.well-known/jwks.json", app.jwks)
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/health", app.healthcheck)
+		r.Get("/search", app.search)
+		r.Get("/files/{key}", app.serveFile)
 
 		r.Group(func(r chi.Router) {
 			r.Use(app.optionalAuthMiddleware)
-			r.Get("/", app.userFeed)
+			r.Get("/", app.requireScope(store.AccessScopePostsRead, app.userFeed))
 		})
 
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/login", app.login)
+			r.Post("/login/mfa", app.loginMFA)
 			r.Post("/register", app.register)
 			r.Patch("/activate/", app.activateUser)
+			r.With(app.limitByIP(5, time.Hour)).Post("/activate/resend", app.resendActivation)
 			r.Post("/token/refresh", app.refreshToken)
 			r.Post("/logout", app.logout)
+			r.Post("/password/forgot", app.forgotPassword)
+			r.Post("/password/reset", app.resetPassword)
+			r.With(app.limitByIP(5, time.Hour)).Post("/magic-link", app.requestMagicLink)
+			r.Post("/magic-link/verify", app.verifyMagicLink)
+			r.Post("/email/confirm", app.confirmEmailChange)
+			r.Get("/oidc/{provider}", app.oidcLogin)
+			// Links are finished here too, by the user who started them.
+			r.With(app.optionalAuthMiddleware).Post("/oidc/{provider}/callback", app.oidcCallback)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthMiddleware)
+				r.Use(app.sessionOnly)
+				r.Get("/sessions", app.listSessions)
+				r.Delete("/sessions", app.revokeAllSessions)
+				r.Delete("/sessions/{sessionID}", app.revokeSession)
+				r.Get("/identities", app.listIdentities)
+				r.Post("/identities/{provider}", app.linkIdentity)
+				r.Get("/tokens", app.listAccessTokens)
+				r.Post("/tokens", app.createAccessToken)
+				r.Delete("/tokens/{tokenID}", app.revokeAccessToken)
+				r.Post("/email", app.requestEmailChange)
+			})
+
+			r.Route("/mfa", func(r chi.Router) {
+				r.Use(app.allowPendingMFAEnrollment)
+				r.Use(app.AuthMiddleware)
+				r.Use(app.sessionOnly)
+				r.Post("/totp", app.enrollTOTP)
+				r.Post("/totp/verify", app.confirmTOTP)
+				r.Delete("/totp", app.disableTOTP)
+				r.Post("/recovery-codes", app.regenerateRecoveryCodes)
+			})
 		})
 
 		r.Route("/posts", func(r chi.Router) {
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthMiddleware)
-				r.Post("/", app.createPost)
-				r.Get("/users/{userID}", app.getPostByUserID)
-				r.Get("/users/", app.getPostByUserID)
+				r.Use(app.requireActivatedUser)
+				r.Post("/", app.requireScope(store.AccessScopePostsWrite, app.createPost))
+				r.Post("/upload", app.requireScope(store.AccessScopePostsWrite, app.uploadPostFiles))
+				r.Get("/users/{userID}", app.requireScope(store.AccessScopePostsRead, app.getPostByUserID))
+				r.Get("/users/", app.requireScope(store.AccessScopePostsRead, app.getPostByUserID))
+				r.Get("/trash", app.requireScope(store.AccessScopePostsRead, app.listTrash))
 			})
 
-			r.Post("/upload", app.uploadPostFiles)
-
 			r.Route("/{postID}", func(r chi.Router) {
 				r.Get("/", app.getPost)
 
 				r.Group(func(r chi.Router) {
-					// r.Use(app.AuthMiddleware)
+					r.Use(app.optionalAuthMiddleware)
+					r.Use(app.postContextMiddleware)
+					r.Get("/revisions", app.requireScope(store.AccessScopePostsRead, app.listPostRevisions))
+					r.Get("/revisions/diff", app.requireScope(store.AccessScopePostsRead, app.diffPostRevisions))
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthMiddleware)
+					r.Use(app.requireActivatedUser)
+					r.Post("/restore", app.requireScope(store.AccessScopePostsWrite, app.restorePost))
+					r.With(app.sessionOnly).Post("/unhide", app.requirePermission(store.PermPostDeleteAny, app.unhidePost))
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthMiddleware)
+					r.Use(app.requireActivatedUser)
 					r.Use(app.postContextMiddleware)
 
-					r.Patch("/", app.checkPostOwnership("moderator", app.updatePost))
-					r.Delete("/", app.checkPostOwnership("admin", app.deletePost))
+					r.Patch("/", app.requireScope(store.AccessScopePostsWrite, app.checkPostOwnership(store.PermPostUpdateAny, app.updatePost)))
+					r.Delete("/", app.requireScope(store.AccessScopePostsWrite, app.checkPostOwnership(store.PermPostDeleteAny, app.deletePost)))
+					r.Post("/report", app.requireScope(store.AccessScopePostsWrite, app.reportPost))
+
+					// What shouldn't stay readable in the history is redacted
+					// by a moderator rather than hidden from everyone.
+					r.With(app.sessionOnly).Post("/revisions/{revision}/redact", app.requirePermission(store.PermPostUpdateAny, app.redactPostRevision))
 
 					r.Route("/likes", func(r chi.Router) {
-						r.Post("/", app.addLike)
-						r.Delete("/", app.removeLike)
+						r.Post("/", app.requireScope(store.AccessScopePostsWrite, app.addLike))
+						r.Delete("/", app.requireScope(store.AccessScopePostsWrite, app.removeLike))
+					})
+				})
+
+				r.Route("/tags", func(r chi.Router) {
+					r.Group(func(r chi.Router) {
+						r.Use(app.optionalAuthMiddleware)
+						r.Use(app.postContextMiddleware)
+						r.Get("/", app.requireScope(store.AccessScopePostsRead, app.listTag))
 					})
 
-					r.Route("/tags", func(r chi.Router) {
-						r.Post("/", app.addTag)
-						r.Get("/", app.listTag)
-						r.Delete("/{tagID}", app.removeTag)
+					r.Group(func(r chi.Router) {
+						r.Use(app.AuthMiddleware)
+						r.Use(app.requireActivatedUser)
+						r.Use(app.postContextMiddleware)
+						r.Post("/", app.requireScope(store.AccessScopePostsWrite, app.addTag))
+						r.Delete("/{tagID}", app.requireScope(store.AccessScopePostsWrite, app.removeTag))
+					})
+				})
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Group(func(r chi.Router) {
+						r.Use(app.optionalAuthMiddleware)
+						r.Use(app.postContextMiddleware)
+						r.Get("/", app.requireScope(store.AccessScopeCommentsRead, app.listComment))
+						r.Get("/{commentID}", app.requireScope(store.AccessScopeCommentsRead, app.getComment))
 					})
 
-					r.Route("/comments", func(r chi.Router) {
-						r.Get("/", app.listComment)
-						r.Post("/", app.createComment)
-						r.Get("/{commentID}", app.getComment)
-						r.Patch("/{commentID}", app.updateComment)
-						r.Delete("/{commentID}", app.deleteComment)
+					r.Group(func(r chi.Router) {
+						r.Use(app.AuthMiddleware)
+						r.Use(app.requireActivatedUser)
+						r.Use(app.postContextMiddleware)
+						r.Post("/", app.requireScope(store.AccessScopeCommentsWrite, app.createComment))
+						r.Patch("/{commentID}", app.requireScope(store.AccessScopeCommentsWrite, app.checkCommentOwnership(store.PermCommentModerate, app.updateComment)))
+						r.Delete("/{commentID}", app.requireScope(store.AccessScopeCommentsWrite, app.checkCommentOwnership(store.PermCommentModerate, app.deleteComment)))
+						r.Post("/{commentID}/replies", app.requireScope(store.AccessScopeCommentsWrite, app.createReply))
+						r.Post("/{commentID}/report", app.requireScope(store.AccessScopeCommentsWrite, app.reportComment))
+						r.Post("/{commentID}/restore", app.requireScope(store.AccessScopeCommentsWrite, app.restoreComment))
+						r.With(app.sessionOnly).Post("/{commentID}/unhide", app.requirePermission(store.PermCommentModerate, app.unhideComment))
+
+						r.Route("/{commentID}/likes", func(r chi.Router) {
+							r.Post("/", app.requireScope(store.AccessScopeCommentsWrite, app.addCommentLike))
+							r.Delete("/", app.requireScope(store.AccessScopeCommentsWrite, app.removeCommentLike))
+						})
 					})
 				})
 			})
@@ -161,17 +288,78 @@ func (app *application) mount() http.Handler {
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthMiddleware)
-				r.Post("/", app.checkResourceAccess("moderator", app.createTag))
+				r.Use(app.requireActivatedUser)
+				r.Post("/", app.requireScope(store.AccessScopeTagsWrite, app.requirePermission(store.PermTagCreate, app.createTag)))
 				r.Get("/{tagID}", app.getTag)
-				r.Delete("/{tagID}", app.checkResourceAccess("moderator", app.deleteTag))
+				r.Delete("/{tagID}", app.requireScope(store.AccessScopeTagsWrite, app.requirePermission(store.PermTagDelete, app.deleteTag)))
 			})
 		})
 
+		r.Route("/roles", func(r chi.Router) {
+			r.Use(app.AuthMiddleware)
+			r.Use(app.sessionOnly)
+			r.Use(app.requireActivatedUser)
+			r.Get("/", app.requirePermission(store.PermRoleManage, app.listRoles))
+			r.Post("/", app.requirePermission(store.PermRoleManage, app.createRole))
+			r.Put("/{roleName}/permissions", app.requirePermission(store.PermRoleManage, app.setRolePermissions))
+			r.Patch("/{roleName}/mfa", app.requirePermission(store.PermRoleManage, app.setRoleMFA))
+			r.Delete("/{roleName}", app.requirePermission(store.PermRoleManage, app.deleteRole))
+		})
+
+		r.Route("/permissions", func(r chi.Router) {
+			r.Use(app.AuthMiddleware)
+			r.Use(app.sessionOnly)
+			r.Get("/", app.requirePermission(store.PermRoleManage, app.listPermissions))
+		})
+
+		r.Route("/reports", func(r chi.Router) {
+			r.Use(app.AuthMiddleware)
+			r.Use(app.sessionOnly)
+			r.Use(app.requireActivatedUser)
+			r.Get("/", app.requirePermission(store.PermReportModerate, app.listReports))
+			r.Get("/{reportID}", app.requirePermission(store.PermReportModerate, app.getReport))
+			r.Post("/{reportID}/assign", app.requirePermission(store.PermReportModerate, app.assignReport))
+			r.Post("/{reportID}/resolve", app.requirePermission(store.PermReportModerate, app.resolveReport))
+			r.Post("/{reportID}/dismiss", app.requirePermission(store.PermReportModerate, app.dismissReport))
+		})
+
+		r.Route("/admin/users", func(r chi.Router) {
+			r.Use(app.AuthMiddleware)
+			r.Use(app.sessionOnly)
+			r.Use(app.requireActivatedUser)
+			r.Get("/", app.requirePermission(store.PermUserManage, app.listUsers))
+			r.Patch("/{userID}/role", app.requirePermission(store.PermRoleManage, app.updateUserRole))
+			r.Post("/{userID}/suspension", app.requirePermission(store.PermUserManage, app.suspendUser))
+			r.Post("/{userID}/ban", app.requirePermission(store.PermUserManage, app.banUser))
+			r.Delete("/{userID}/suspension", app.requirePermission(store.PermUserManage, app.liftSuspension))
+		})
+
+		r.Route("/admin/audit", func(r chi.Router) {
+			r.Use(app.AuthMiddleware)
+			r.Use(app.sessionOnly)
+			r.Get("/", app.requirePermission(store.PermAuditRead, app.listAuditEvents))
+		})
+
 		r.Route("/users", func(r chi.Router) {
 			r.Use(app.AuthMiddleware)
-			// r.Patch("/{userName}", app.checkResourceAccess("admin", app.updateUserRole))
-			r.Get("/{userID}", app.profile)
-			r.Get("/", app.profile)
+
+			// Unactivated accounts can still take their data and leave.
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.sessionOnly)
+				r.Delete("/", app.deleteAccount)
+				r.Post("/deletion/cancel", app.cancelAccountDeletion)
+				r.Get("/export", app.requestExport)
+				r.Get("/exports/{exportID}", app.getExport)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireActivatedUser)
+				r.Get("/{userID}", app.requireScope(store.AccessScopeUsersRead, app.profile))
+				r.Post("/{userID}/follow", app.requireScope(store.AccessScopeUsersWrite, app.followUser))
+				r.Delete("/{userID}/follow", app.requireScope(store.AccessScopeUsersWrite, app.unfollowUser))
+				r.With(app.sessionOnly).Post("/{userID}/unlock", app.requirePermission(store.PermUserManage, app.unlockUser))
+				r.Get("/", app.requireScope(store.AccessScopeUsersRead, app.profile))
+			})
 		})
 	})
 
@@ -189,6 +377,13 @@ func (app *application) run(mux http.Handler) error {
 
 	shutdown := make(chan error)
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	app.background(func() {
+		app.runPurger(jobsCtx)
+	})
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -200,7 +395,13 @@ func (app *application) run(mux http.Handler) error {
 
 		app.logger.Info("signal caught", "signal", s.String())
 
-		shutdown <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+
+		// Let exports and emails that are already running finish.
+		stopJobs()
+		app.wg.Wait()
+
+		shutdown <- err
 	}()
 
 	app.logger.Info("server has started", "addr", app.config.addr, "env", app.config.env)
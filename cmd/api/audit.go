@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"newsdrop.org/store"
+)
+
+const auditPageSize = 50
+
+// audit records a privileged action in the audit log and the security log.
+// before and after are snapshots of the target on either side of the change;
+// either may be nil. Pass the transaction the change is made in, so that the
+// change doesn't happen without its record.
+func (app *application) audit(s *store.Storage, r *http.Request, action, targetType string, targetID any, before, after any) error {
+	actor := getUserFromContext(r)
+
+	event := &store.AuditEvent{
+		ActorID:    &actor.ID,
+		ActorName:  actor.Name,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		RequestID:  middleware.GetReqID(r.Context()),
+		IP:         clientIP(r),
+	}
+
+	var err error
+	if event.Before, err = auditSnapshot(before); err != nil {
+		return err
+	}
+	if event.After, err = auditSnapshot(after); err != nil {
+		return err
+	}
+
+	if err := s.AuditLog.Create(r.Context(), event); err != nil {
+		return err
+	}
+
+	app.logSecurityEvent(r, action, "actor_id", actor.ID, "target_type", event.TargetType, "target_id", event.TargetID)
+
+	return nil
+}
+
+// auditSnapshot encodes v, keeping a missing snapshot as SQL NULL rather than
+// JSON null.
+func auditSnapshot(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+type ListAuditEventsQuery struct {
+	Action     string `validate:"max=100"`
+	TargetType string `validate:"max=50"`
+	TargetID   string `validate:"max=255"`
+	Page       int64  `validate:"min=1"`
+}
+
+func (app *application) listAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	query := ListAuditEventsQuery{
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Page:       1,
+	}
+
+	if pageStr := q.Get("page"); pageStr != "" {
+		page, err := strconv.ParseInt(pageStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.Page = page
+	}
+
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	filter := store.AuditFilter{
+		Action:     query.Action,
+		TargetType: query.TargetType,
+		TargetID:   query.TargetID,
+	}
+
+	if actorStr := q.Get("actor_id"); actorStr != "" {
+		actorID, err := strconv.ParseInt(actorStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		filter.ActorID = &actorID
+	}
+
+	// since and until are RFC 3339 timestamps; until is exclusive.
+	var err error
+	if filter.Since, err = timeQueryParam(q, "since"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if filter.Until, err = timeQueryParam(q, "until"); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	total, events, err := app.store.AuditLog.List(r.Context(), filter, auditPageSize, (query.Page-1)*auditPageSize)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "success",
+		"page":    query.Page,
+		"total":   total,
+		"events":  events,
+	})
+}
+
+func timeQueryParam(q url.Values, name string) (*time.Time, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &t, nil
+}
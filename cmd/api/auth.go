@@ -9,12 +9,14 @@ import (
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"newsdrop.org/auth"
+	"newsdrop.org/mailer"
 	"newsdrop.org/store"
 )
 
 type LoginPayload struct {
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=6,max=72"`
+	Device   string `json:"device" validate:"max=100"`
 }
 
 func (app *application) login(w http.ResponseWriter, r *http.Request) {
@@ -30,35 +32,66 @@ func (app *application) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	until, err := app.loginLockedUntil(r.Context(), payload.Email, clientIP(r))
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if !until.IsZero() {
+		app.loginLockedResponse(w, r, until)
+		return
+	}
+
+	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.loginFailed(w, r, payload.Email, nil, ErrInvalidCredentials)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
 	if err := user.Password.Compare(payload.Password); err != nil {
-		app.unauthorizedErrorResponse(w, r, err)
+		app.loginFailed(w, r, payload.Email, user, err)
+		return
+	}
+
+	if err := app.cache.LoginAttempts.Reset(r.Context(), emailLoginSubject(user.Email)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user.MFAEnabled {
+		app.mfaChallenge(w, r, user)
 		return
 	}
 
-	token, err := auth.IssueTokens(strconv.FormatInt(user.ID, 10))
+	app.startSession(w, r, user, payload.Device)
+}
+
+// startSession signs the user in on a new device and writes the tokens.
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, user *store.User, device string) {
+	if app.rejectSuspended(w, r, user) {
+		return
+	}
+
+	session := newSession(r, user.ID, device)
+
+	token, err := app.jwtKeys.IssueTokens(strconv.FormatInt(user.ID, 10), session.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := auth.Persist(r.Context(), &app.cache, token); err != nil {
+	if err := auth.Persist(r.Context(), &app.cache, token, session); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	// auth.SetAuthCookies(w, token)
-	app.jsonResponse(w, http.StatusOK, envelope{
-		"message":       "success",
-		"user":          user,
-		"access_token":  token.Access,
-		"refresh_token": token.Refresh,
-	})
+	app.writeTokens(w, r, http.StatusOK, user, token)
 }
 
 type RegisterPayload struct {
@@ -106,9 +139,9 @@ func (app *application) register(w http.ResponseWriter, r *http.Request) {
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
 			switch pgErr.ConstraintName {
 			case "users_email_key":
-				app.badRequestResponse(w, r, ErrDuplicateEmail)
+				app.conflictError(w, r, ErrDuplicateEmail)
 			case "users_name_key":
-				app.badRequestResponse(w, r, ErrDuplicateName)
+				app.conflictError(w, r, ErrDuplicateName)
 			default:
 				app.internalServerError(w, r, err)
 			}
@@ -118,30 +151,39 @@ func (app *application) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := app.store.Tokens.New(user.ID, 3*24*time.Hour, store.ScopeActivation)
+	token, err := app.store.Tokens.New(user.ID, activationTTL, store.ScopeActivation)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	app.sendActivationEmail(user, token)
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message": "user registered",
+		"user":    user,
+	})
+}
+
+func (app *application) sendActivationEmail(user *store.User, token *store.Token) {
 	isProd := app.config.env == "prod"
 
 	app.background(func() {
 		data := map[string]any{
 			"Username":      user.Name,
-			"ActivationURL": fmt.Sprintf("http://localhost:5173/activate?token=%s", token.Plaintext),
+			"ActivationURL": fmt.Sprintf("%s/activate?token=%s", app.config.frontendURL, token.Plaintext),
 		}
 
-		err = app.mailer.SendAPI("user_welcome.tmpl", user.Name, user.Email, data, !isProd)
+		err := app.mailer.SendAPI(mailer.UserWelcomeTemplate, user.Name, user.Email, data, !isProd)
 		if err != nil {
-			app.internalServerError(w, r, err)
+			app.logger.Error("error sending activation email", "user_id", user.ID, "error", err)
 		}
 	})
+}
 
-	app.jsonResponse(w, http.StatusCreated, envelope{
-		"message": "user registered",
-		"user":    user,
-	})
+func (app *application) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, app.jwtKeys.JWKS())
 }
 
 func getUserFromContext(r *http.Request) *store.User {
@@ -153,66 +195,124 @@ func getUserFromContext(r *http.Request) *store.User {
 }
 
 func (app *application) refreshToken(w http.ResponseWriter, r *http.Request) {
-	ref, err := auth.MustCookie(r, "refresh_token")
+	ref, err := app.refreshTokenFromRequest(w, r)
 	if err != nil {
 		app.unauthorizedErrorResponse(w, r, err)
 		return
 	}
 
-	claims, err := auth.ParseRefresh(ref)
+	claims, err := app.jwtKeys.ParseRefresh(ref)
 	if err != nil {
 		app.unauthorizedErrorResponse(w, r, err)
 		return
 	}
 	if _, err := app.cache.Sessions.GetUser(r.Context(), "refresh:"+claims.ID); err != nil {
+		familyID, retiredErr := app.cache.Sessions.GetRetiredRefreshToken(r.Context(), claims.ID)
+		if retiredErr == nil {
+			app.revokeTokenFamily(w, r, familyID, claims)
+			return
+		}
 		app.unauthorizedErrorResponse(w, r, err)
 		return
 	}
-	_ = app.cache.Sessions.Delete(r.Context(), "refresh:"+claims.ID)
 
-	toks, err := auth.IssueTokens(claims.Subject)
+	session, err := app.cache.Sessions.GetSession(r.Context(), claims.SessionID)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		app.unauthorizedErrorResponse(w, r, err)
 		return
 	}
-
-	if err := auth.Persist(r.Context(), &app.cache, toks); err != nil {
-		app.internalServerError(w, r, err)
+	if session.RefreshJTI != claims.ID {
+		app.revokeTokenFamily(w, r, session.ID, claims)
 		return
 	}
-	auth.SetAuthCookies(w, toks)
-	app.jsonResponse(w, http.StatusCreated, envelope{
-		"message": "success",
-	})
-}
 
-func (app *application) logout(w http.ResponseWriter, r *http.Request) {
-	accessCookie, err := r.Cookie("access_token")
+	// Retiring the token is what claims it. Two requests racing with the
+	// same token both get this far, but only one of them wins; the other is
+	// a reuse like any other.
+	claimed, err := app.cache.Sessions.RetireRefreshToken(r.Context(), claims.ID, session.ID, claims.ExpiresAt.Time)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	acc := accessCookie.Value
+	if !claimed {
+		app.revokeTokenFamily(w, r, session.ID, claims)
+		return
+	}
 
-	refreshCookie, err := r.Cookie("refresh_token")
+	oldAccessJTI, oldRefreshJTI := session.AccessJTI, session.RefreshJTI
+	session.IP = clientIP(r)
+	session.UserAgent = r.UserAgent()
+
+	toks, err := app.jwtKeys.IssueTokens(claims.Subject, session.ID)
+	if err == nil {
+		err = auth.Persist(r.Context(), &app.cache, toks, session)
+	}
 	if err != nil {
+		// The session still points at the old token; let it be used again.
+		if releaseErr := app.cache.Sessions.ReleaseRefreshToken(r.Context(), claims.ID); releaseErr != nil {
+			app.logger.Error("error releasing refresh token", "jti", claims.ID, "error", releaseErr)
+		}
 		app.internalServerError(w, r, err)
 		return
 	}
-	ref := refreshCookie.Value
 
-	if acc != "" {
-		if claims, err := auth.ParseAccess(acc); err == nil {
-			_ = app.cache.Sessions.Delete(r.Context(), "access"+claims.ID)
+	// The new tokens are live, so failing now would only cost the client
+	// them. A leftover refresh key is caught as reuse since the session has
+	// moved on, and the access key runs out on its own.
+	for _, key := range []string{"refresh:" + oldRefreshJTI, "access:" + oldAccessJTI} {
+		if err := app.cache.Sessions.Delete(r.Context(), key); err != nil {
+			app.logger.Error("error deleting rotated token", "key", key, "error", err)
+		}
+	}
+
+	app.writeTokens(w, r, http.StatusCreated, nil, toks)
+}
+
+// revokeTokenFamily handles a refresh token that was already rotated out
+// being presented again. Either the legitimate client or an attacker holds a
+// stolen copy, and there is no telling which, so the whole session goes.
+func (app *application) revokeTokenFamily(w http.ResponseWriter, r *http.Request, familyID string, claims *auth.Claims) {
+	if session, err := app.cache.Sessions.GetSession(r.Context(), familyID); err == nil {
+		if err := app.cache.Sessions.DeleteSession(r.Context(), session); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	app.logSecurityEvent(r, "refresh_token_reuse",
+		"user_id", claims.Subject,
+		"session_id", familyID,
+		"jti", claims.ID,
+	)
+
+	app.clearAuthCookies(w)
+	app.unauthorizedErrorResponse(w, r, errors.New("refresh token reuse detected"))
+}
+
+func (app *application) logout(w http.ResponseWriter, r *http.Request) {
+	var sessionID string
+
+	if acc := app.accessTokenFromRequest(r); acc != "" {
+		if claims, err := app.jwtKeys.ParseAccess(acc); err == nil {
+			sessionID = claims.SessionID
+			_ = app.cache.Sessions.Delete(r.Context(), "access:"+claims.ID)
+		}
+	}
+
+	if ref, err := app.refreshTokenFromRequest(w, r); err == nil && ref != "" {
+		if claims, err := app.jwtKeys.ParseRefresh(ref); err == nil {
+			sessionID = claims.SessionID
+			_ = app.cache.Sessions.Delete(r.Context(), "refresh:"+claims.ID)
 		}
 	}
 
-	if ref != "" {
-		if claims, err := auth.ParseRefresh(ref); err == nil {
-			_ = app.cache.Sessions.Delete(r.Context(), "refresh"+claims.ID)
+	if sessionID != "" {
+		if session, err := app.cache.Sessions.GetSession(r.Context(), sessionID); err == nil {
+			_ = app.cache.Sessions.DeleteSession(r.Context(), session)
 		}
 	}
-	auth.ClearAuthCookies(w)
+
+	app.clearAuthCookies(w)
 	app.jsonResponse(w, http.StatusOK, envelope{
 		"message": "success",
 	})
@@ -264,3 +364,211 @@ func (app *application) activateUser(w http.ResponseWriter, r *http.Request) {
 		"user": user,
 	})
 }
+
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+const (
+	activationTTL            = 3 * 24 * time.Hour
+	activationResendCooldown = 5 * time.Minute
+)
+
+func (app *application) resendActivation(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Same response for unknown, already active and throttled accounts so
+	// the endpoint can't be used to enumerate accounts.
+	response := envelope{
+		"message": "if an unactivated account with that email exists, an activation link has been sent",
+	}
+
+	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.jsonResponse(w, http.StatusAccepted, response)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.Activated {
+		app.jsonResponse(w, http.StatusAccepted, response)
+		return
+	}
+
+	// One email per account per cooldown, however many IPs ask for it.
+	cooldownKey := "activation_resend:" + strconv.FormatInt(user.ID, 10)
+	started, err := app.cache.Ephemeral.SetNX(r.Context(), cooldownKey, "1", activationResendCooldown)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !started {
+		app.logSecurityEvent(r, "activation_resend_throttled", "user_id", user.ID)
+		app.jsonResponse(w, http.StatusAccepted, response)
+		return
+	}
+
+	var token *store.Token
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Tokens.Delete(store.ScopeActivation, user.ID); err != nil {
+			return err
+		}
+		token, err = s.Tokens.New(user.ID, activationTTL, store.ScopeActivation)
+		return err
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.sendActivationEmail(user, token)
+
+	app.jsonResponse(w, http.StatusAccepted, response)
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+const passwordResetTTL = 30 * time.Minute
+
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Respond the same way whether or not the email is registered so the
+	// endpoint can't be used to enumerate accounts.
+	response := envelope{
+		"message": "if an account with that email exists, a password reset link has been sent",
+	}
+
+	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.jsonResponse(w, http.StatusAccepted, response)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	err = app.store.Tokens.Delete(store.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	token, err := app.store.Tokens.New(user.ID, passwordResetTTL, store.ScopePasswordReset)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	isProd := app.config.env == "prod"
+
+	app.background(func() {
+		data := map[string]any{
+			"Username":  user.Name,
+			"ResetURL":  fmt.Sprintf("%s/password/reset?token=%s", app.config.frontendURL, token.Plaintext),
+			"ExpiresIn": passwordResetTTL.String(),
+		}
+
+		err := app.mailer.SendAPI(mailer.PasswordResetTemplate, user.Name, user.Email, data, !isProd)
+		if err != nil {
+			app.logger.Error("error sending password reset email", "user_id", user.ID, "error", err)
+		}
+	})
+
+	app.jsonResponse(w, http.StatusAccepted, response)
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,max=72"`
+}
+
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Consuming the token first means two requests racing with it can't
+	// both set a password.
+	var user *store.User
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		userID, err := s.Tokens.Consume(store.ScopePasswordReset, payload.Token)
+		if err != nil {
+			return err
+		}
+
+		if user, err = s.Users.GetByID(r.Context(), userID); err != nil {
+			return err
+		}
+
+		if err := user.Password.Set(payload.Password); err != nil {
+			return err
+		}
+		if err := s.Users.Update(user); err != nil {
+			return err
+		}
+		// A pending email change may be how the account is being taken
+		// over; make it unconfirmable.
+		if err := s.Tokens.Delete(store.ScopeEmailChange, user.ID); err != nil {
+			return err
+		}
+		if err := s.AccessTokens.DeleteByUser(r.Context(), user.ID); err != nil {
+			return err
+		}
+		return s.Tokens.Delete(store.ScopePasswordReset, user.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.cache.Sessions.DeleteByUser(r.Context(), strconv.FormatInt(user.ID, 10)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "password updated",
+	})
+}
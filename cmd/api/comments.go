@@ -5,9 +5,15 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"newsdrop.org/store"
 )
 
+const (
+	defaultCommentDepth = 3
+	maxCommentDepth     = 10
+)
+
 type CommentPayload struct {
 	Content string `json:"content" validate:"required,min=1,max=2048"`
 }
@@ -31,7 +37,7 @@ func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
 	var comment *store.Comment
 	var err error
 	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		comment, err = app.store.Comments.Create(r.Context(), payload.Content, user.ID, post.ID)
+		comment, err = s.Comments.Create(r.Context(), payload.Content, user.ID, post.ID, nil)
 		if err != nil {
 			return err
 		}
@@ -48,6 +54,64 @@ func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (app *application) createReply(w http.ResponseWriter, r *http.Request) {
+	var payload CommentPayload
+
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	commentIDStr := r.PathValue("commentID")
+	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	parent, err := app.store.Comments.GetByID(r.Context(), commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if parent.PostID != post.ID || parent.HiddenAt != nil {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	var comment *store.Comment
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		comment, err = s.Comments.Create(r.Context(), payload.Content, user.ID, post.ID, &parent.ID)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message": "reply created",
+		"comment": comment,
+	})
+}
+
 func (app *application) getComment(w http.ResponseWriter, r *http.Request) {
 	commentIDStr := r.PathValue("commentID")
 	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
@@ -67,6 +131,11 @@ func (app *application) getComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if comment.PostID != getPostFromContext(r).ID || comment.HiddenAt != nil {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
 	app.jsonResponse(w, http.StatusOK, envelope{
 		"message": "success",
 		"comment": comment,
@@ -86,19 +155,18 @@ func (app *application) updateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commentIDStr := r.PathValue("commentID")
-	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
+	before := getCommentFromContext(r)
 
 	var comment *store.Comment
+	var err error
 	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		comment, err = app.store.Comments.Update(r.Context(), payload.Content, commentID)
+		comment, err = s.Comments.Update(r.Context(), payload.Content, before.ID)
 		if err != nil {
 			return err
 		}
+		if before.UserID != getUserFromContext(r).ID {
+			return app.audit(s, r, "comment_updated", "comment", comment.ID, before, comment)
+		}
 		return nil
 	})
 	if err != nil {
@@ -113,18 +181,16 @@ func (app *application) updateComment(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) deleteComment(w http.ResponseWriter, r *http.Request) {
-	commentIDStr := r.PathValue("commentID")
-	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
+	comment := getCommentFromContext(r)
 
-	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		err := app.store.Comments.Delete(r.Context(), commentID)
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		err := s.Comments.Delete(r.Context(), comment.ID, getUserFromContext(r).ID)
 		if err != nil {
 			return err
 		}
+		if comment.UserID != getUserFromContext(r).ID {
+			return app.audit(s, r, "comment_deleted", "comment", comment.ID, comment, nil)
+		}
 		return nil
 	})
 	if err != nil {
@@ -161,7 +227,20 @@ func (app *application) listComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commentCount, comments, err := app.store.Comments.List(r.Context(), post.ID, sortBy, 20, (page-1)*20)
+	depth := int64(defaultCommentDepth)
+	if depthStr := r.URL.Query().Get("depth"); depthStr != "" {
+		depth, err = strconv.ParseInt(depthStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if depth < 0 || depth > maxCommentDepth {
+			app.badRequestResponse(w, r, errors.New("invalid depth"))
+			return
+		}
+	}
+
+	commentCount, comments, err := app.store.Comments.List(r.Context(), post.ID, sortBy, depth, 20, (page-1)*20)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -173,3 +252,106 @@ func (app *application) listComment(w http.ResponseWriter, r *http.Request) {
 		"comments":      comments,
 	})
 }
+
+func (app *application) addCommentLike(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	commentIDStr := r.PathValue("commentID")
+	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment, err := app.store.Comments.GetByID(r.Context(), commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if comment.PostID != post.ID || comment.HiddenAt != nil {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	var commentLike *store.CommentLike
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		commentLike, err = s.CommentLikes.Create(r.Context(), user.ID, comment.ID)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			switch pgErr.ConstraintName {
+			case "comment_likes_pkey":
+				app.badRequestResponse(w, r, ErrDuplicateCommentLike)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message":      "like added",
+		"comment_like": commentLike,
+	})
+}
+
+func (app *application) removeCommentLike(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	commentIDStr := r.PathValue("commentID")
+	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment, err := app.store.Comments.GetByID(r.Context(), commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if comment.PostID != post.ID {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		return s.CommentLikes.Delete(r.Context(), user.ID, comment.ID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	return r.Context().Value(commentCtx).(*store.Comment)
+}
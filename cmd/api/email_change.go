@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"newsdrop.org/mailer"
+	"newsdrop.org/store"
+)
+
+var ErrSameEmail = errors.New("new email is the current email")
+
+const emailChangeTTL = 24 * time.Hour
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+func (app *application) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeEmailPayload
+
+	user := getUserFromContext(r)
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// A stolen session alone shouldn't be enough to move the account to
+	// another address.
+	if err := user.Password.Compare(payload.Password); err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	if strings.EqualFold(payload.Email, user.Email) {
+		app.badRequestResponse(w, r, ErrSameEmail)
+		return
+	}
+
+	_, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	switch {
+	case err == nil:
+		app.conflictError(w, r, ErrDuplicateEmail)
+		return
+	case !errors.Is(err, store.ErrNotFound):
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var token *store.Token
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if _, err := s.EmailChanges.Create(r.Context(), user.ID, payload.Email); err != nil {
+			return err
+		}
+		if err := s.Tokens.Delete(store.ScopeEmailChange, user.ID); err != nil {
+			return err
+		}
+		token, err = s.Tokens.New(user.ID, emailChangeTTL, store.ScopeEmailChange)
+		return err
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	isProd := app.config.env == "prod"
+
+	app.background(func() {
+		confirm := map[string]any{
+			"Username":   user.Name,
+			"NewEmail":   payload.Email,
+			"ConfirmURL": fmt.Sprintf("%s/email/confirm?token=%s", app.config.frontendURL, token.Plaintext),
+			"ExpiresIn":  emailChangeTTL.String(),
+		}
+		if err := app.mailer.SendAPI(mailer.EmailChangeTemplate, user.Name, payload.Email, confirm, !isProd); err != nil {
+			app.logger.Error("error sending email change confirmation", "user_id", user.ID, "error", err)
+		}
+
+		notice := map[string]any{
+			"Username": user.Name,
+			"NewEmail": payload.Email,
+			"ResetURL": fmt.Sprintf("%s/password/forgot", app.config.frontendURL),
+		}
+		if err := app.mailer.SendAPI(mailer.EmailNoticeTemplate, user.Name, user.Email, notice, !isProd); err != nil {
+			app.logger.Error("error sending email change notice", "user_id", user.ID, "error", err)
+		}
+	})
+
+	app.jsonResponse(w, http.StatusAccepted, envelope{
+		"message": "check your new email address to confirm the change",
+	})
+}
+
+type ConfirmEmailChangePayload struct {
+	Token string `json:"token" validate:"required,max=64"`
+}
+
+func (app *application) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var payload ConfirmEmailChangePayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var change *store.EmailChange
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		userID, err := s.Tokens.Consume(store.ScopeEmailChange, payload.Token)
+		if err != nil {
+			return err
+		}
+
+		change, err = s.EmailChanges.Take(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.Users.UpdateEmail(r.Context(), userID, change.NewEmail); err != nil {
+			return err
+		}
+
+		// Links mailed to the old address shouldn't outlive it.
+		if err := s.Tokens.Delete(store.ScopeLogin, userID); err != nil {
+			return err
+		}
+		return s.Tokens.Delete(store.ScopePasswordReset, userID)
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_email_key":
+			app.conflictError(w, r, ErrDuplicateEmail)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "email updated",
+		"email":   change.NewEmail,
+	})
+}
@@ -3,12 +3,18 @@ package main
 import (
 	"errors"
 	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"newsdrop.org/store"
 )
 
 var (
-	ErrDuplicateEmail = errors.New("email already exists")
-	ErrDuplicateName  = errors.New("username already exists")
-	ErrDuplicateLike  = errors.New("can't like a post twice")
+	ErrDuplicateEmail       = errors.New("email already exists")
+	ErrDuplicateName        = errors.New("username already exists")
+	ErrDuplicateLike        = errors.New("can't like a post twice")
+	ErrDuplicateCommentLike = errors.New("can't like a comment twice")
+	ErrSelfFollow           = errors.New("can't follow yourself")
+	ErrAccountNotActivated  = errors.New("account is not activated, check your email for the activation link")
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -42,7 +48,58 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
 }
 
+func (app *application) logSecurityEvent(r *http.Request, event string, args ...any) {
+	args = append([]any{
+		"event", event,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"ip", clientIP(r),
+		"request_id", middleware.GetReqID(r.Context()),
+	}, args...)
+	app.logger.Warn("security event", args...)
+}
+
 func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
 	app.logger.Warn("forbidden: ", "method", r.Method, "path", r.URL.Path)
 	writeJSON(w, http.StatusForbidden, "forbidden")
 }
+
+func (app *application) mfaRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warn("mfa enrollment required: ", "method", r.Method, "path", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, ErrMFARequired.Error())
+}
+
+func (app *application) oidcAccountExistsResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warn("oidc account exists: ", "method", r.Method, "path", r.URL.Path)
+	writeJSONError(w, http.StatusConflict, ErrOIDCAccountExists.Error())
+}
+
+func (app *application) deletionPendingResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warn("account pending deletion: ", "method", r.Method, "path", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, ErrDeletionPending.Error())
+}
+
+func (app *application) activationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warn("account not activated: ", "method", r.Method, "path", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, ErrAccountNotActivated.Error())
+}
+
+func (app *application) suspendedResponse(w http.ResponseWriter, r *http.Request, suspension *store.Suspension) {
+	app.logger.Warn("account suspended: ", "method", r.Method, "path", r.URL.Path, "user_id", suspension.UserID)
+
+	err := ErrAccountSuspended
+	if suspension.Permanent() {
+		err = ErrAccountBanned
+	}
+
+	writeJSON(w, http.StatusForbidden, envelope{
+		"error":      err.Error(),
+		"reason":     suspension.Reason,
+		"expires_at": suspension.ExpiresAt,
+	})
+}
+
+func (app *application) csrfFailedResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warn("csrf check failed: ", "method", r.Method, "path", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, ErrCSRFTokenMismatch.Error())
+}
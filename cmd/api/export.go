@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"newsdrop.org/mailer"
+	"newsdrop.org/storage"
+	"newsdrop.org/store"
+)
+
+var ErrExportNotReady = errors.New("export is not ready yet")
+
+const (
+	// exportTTL is how long a finished archive stays downloadable.
+	exportTTL = 7 * 24 * time.Hour
+	// exportCooldown is how long a user waits before asking for a fresh
+	// export; until then they get the latest one back.
+	exportCooldown = 24 * time.Hour
+	exportTimeout  = 10 * time.Minute
+)
+
+func (app *application) requestExport(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	latest, err := app.store.Exports.GetLatest(r.Context(), user.ID)
+	switch {
+	case err == nil && (latest.Status == store.ExportPending || time.Since(latest.CreatedAt) < exportCooldown):
+		app.exportResponse(w, r, latest)
+		return
+	case err != nil && !errors.Is(err, store.ErrNotFound):
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	export, err := app.store.Exports.Create(r.Context(), user.ID, time.Now().Add(exportTTL))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+
+		if err := app.buildExport(ctx, user, export); err != nil {
+			app.logger.Error("error building export", "user_id", user.ID, "export_id", export.ID, "error", err)
+			if err := app.store.Exports.MarkFailed(ctx, export.ID); err != nil {
+				app.logger.Error("error marking export failed", "export_id", export.ID, "error", err)
+			}
+			return
+		}
+
+		data := map[string]any{
+			"Username":    user.Name,
+			"DownloadURL": fmt.Sprintf("%s/account/exports/%s", app.config.frontendURL, export.ID),
+			"ExpiresIn":   exportTTL.String(),
+		}
+		if err := app.mailer.SendAPI(mailer.ExportReadyTemplate, user.Name, user.Email, data, app.config.env != "prod"); err != nil {
+			app.logger.Error("error sending export ready email", "user_id", user.ID, "error", err)
+		}
+	})
+
+	app.jsonResponse(w, http.StatusAccepted, envelope{
+		"message": "your export is being prepared, we'll email you when it's ready",
+		"export":  export,
+	})
+}
+
+func (app *application) getExport(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	export, err := app.store.Exports.GetByID(r.Context(), exportID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.exportResponse(w, r, export)
+}
+
+// exportResponse adds a short-lived download link once the archive is ready.
+func (app *application) exportResponse(w http.ResponseWriter, r *http.Request, export *store.Export) {
+	if export.Status != store.ExportReady {
+		app.jsonResponse(w, http.StatusAccepted, envelope{
+			"message": ErrExportNotReady.Error(),
+			"export":  export,
+		})
+		return
+	}
+
+	link, err := app.storage.GetURL(r.Context(), *export.ObjectKey)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":      "success",
+		"export":       export,
+		"download_url": link,
+	})
+}
+
+// buildExport writes the user's data to a ZIP archive on disk, then uploads
+// it so a large archive never has to sit in memory.
+func (app *application) buildExport(ctx context.Context, user *store.User, export *store.Export) error {
+	tmp, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := app.writeExport(ctx, tmp, user); err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("export-%s.zip", export.ID)
+	if err := app.storage.Save(ctx, tmp, ".zip", key); err != nil {
+		return err
+	}
+
+	return app.store.Exports.MarkReady(ctx, export.ID, key)
+}
+
+func (app *application) writeExport(ctx context.Context, w io.Writer, user *store.User) error {
+	posts, err := app.store.Posts.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	comments, err := app.store.Comments.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	postLikes, err := app.store.PostLikes.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	commentLikes, err := app.store.CommentLikes.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	tags, err := app.store.Tags.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	files, err := app.store.PostFiles.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	documents := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", user},
+		{"posts.json", posts},
+		{"comments.json", comments},
+		{"likes.json", map[string]any{"posts": postLikes, "comments": commentLikes}},
+		{"tags.json", tags},
+		{"media.json", files},
+	}
+
+	for _, doc := range documents {
+		f, err := zw.Create(doc.name)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc.data); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		name := file.FileID.String() + file.FileExtension
+
+		if err := copyToZip(ctx, zw, app.storage, name, "media/"+name); err != nil {
+			// The post row can outlive its object; the export is still
+			// worth having without it.
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				app.logger.Warn("export: media object missing", "user_id", user.ID, "file", name)
+				continue
+			}
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func copyToZip(ctx context.Context, zw *zip.Writer, s storage.Storage, key, name string) error {
+	src, err := s.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	return err
+}
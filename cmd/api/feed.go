@@ -36,7 +36,7 @@ func (app *application) userFeed(w http.ResponseWriter, r *http.Request) {
 	for _, post := range posts {
 		links := make([]string, 0, len(post.Post.FileIDs))
 		for j := range len(post.Post.FileIDs) {
-			link, err := app.storage.GetFromR2(r.Context(), fmt.Sprintf("%s%s", post.Post.FileIDs[j].String(), post.Post.FileExtensions[j]))
+			link, err := app.storage.GetURL(r.Context(), fmt.Sprintf("%s%s", post.Post.FileIDs[j].String(), post.Post.FileExtensions[j]))
 			if err != nil {
 				app.internalServerError(w, r, err)
 				return
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"newsdrop.org/storage"
+)
+
+func (app *application) serveFile(w http.ResponseWriter, r *http.Request) {
+	srv, ok := app.storage.(storage.Server)
+	if !ok {
+		app.notFoundError(w, r, errors.New("file serving is not supported by the storage backend"))
+		return
+	}
+
+	key := r.PathValue("key")
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+
+	if err := srv.Verify(key, expires, signature); err != nil {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	file, err := srv.Open(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound), errors.Is(err, storage.ErrInvalidKey):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	if contentType := mime.TypeByExtension(filepath.Ext(key)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err := io.Copy(w, file); err != nil {
+		app.logger.Error("error serving file", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"newsdrop.org/mailer"
+	"newsdrop.org/store"
+	"newsdrop.org/store/cache"
+)
+
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+const (
+	// Failures are forgotten an hour after the first one.
+	loginFailureWindow = time.Hour
+
+	// Past the threshold every failure locks the subject out for twice as
+	// long as the last one, up to maxLoginLockout.
+	emailLockoutThreshold = 5
+	ipLockoutThreshold    = 20
+	baseLoginLockout      = time.Minute
+	maxLoginLockout       = time.Hour
+)
+
+func emailLoginSubject(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLoginSubject(ip string) string {
+	return "ip:" + ip
+}
+
+func loginLockoutDuration(failures, threshold int64) time.Duration {
+	exp := failures - threshold
+	if exp > 6 {
+		exp = 6
+	}
+
+	d := baseLoginLockout * time.Duration(math.Pow(2, float64(exp)))
+	return min(d, maxLoginLockout)
+}
+
+// loginLockedUntil returns the later lockout of the email and the client IP,
+// or the zero time if neither is locked.
+func (app *application) loginLockedUntil(ctx context.Context, email, ip string) (time.Time, error) {
+	var until time.Time
+
+	for _, subject := range []string{emailLoginSubject(email), ipLoginSubject(ip)} {
+		t, err := app.cache.LoginAttempts.LockedUntil(ctx, subject)
+		if errors.Is(err, cache.ErrCacheMiss) {
+			continue
+		} else if err != nil {
+			return time.Time{}, err
+		}
+
+		if t.After(until) {
+			until = t
+		}
+	}
+
+	return until, nil
+}
+
+// recordLoginFailure counts a failed attempt against the email and the client
+// IP and locks either out once it crosses its threshold. user is nil when no
+// account has that email; failures are counted all the same so lockouts
+// don't reveal which emails are registered.
+func (app *application) recordLoginFailure(r *http.Request, email string, user *store.User) error {
+	ctx := r.Context()
+	ip := clientIP(r)
+
+	ipFailures, err := app.cache.LoginAttempts.Fail(ctx, ipLoginSubject(ip), loginFailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if ipFailures >= ipLockoutThreshold {
+		lockout := loginLockoutDuration(ipFailures, ipLockoutThreshold)
+		if err := app.cache.LoginAttempts.Lock(ctx, ipLoginSubject(ip), time.Now().Add(lockout)); err != nil {
+			return err
+		}
+		app.logSecurityEvent(r, "login_ip_locked", "failures", ipFailures, "locked_for", lockout.String())
+	}
+
+	emailFailures, err := app.cache.LoginAttempts.Fail(ctx, emailLoginSubject(email), loginFailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if err := app.cache.LoginAttempts.AddSource(ctx, emailLoginSubject(email), ip, loginFailureWindow); err != nil {
+		return err
+	}
+
+	if emailFailures < emailLockoutThreshold {
+		return nil
+	}
+
+	lockout := loginLockoutDuration(emailFailures, emailLockoutThreshold)
+	if err := app.cache.LoginAttempts.Lock(ctx, emailLoginSubject(email), time.Now().Add(lockout)); err != nil {
+		return err
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	app.logSecurityEvent(r, "login_account_locked", "user_id", user.ID, "failures", emailFailures, "locked_for", lockout.String())
+
+	// Only mail on the first lockout in a window, not on every backoff step.
+	if emailFailures == emailLockoutThreshold {
+		app.sendAccountLockedEmail(user, emailFailures, ip, lockout)
+	}
+
+	return nil
+}
+
+func (app *application) sendAccountLockedEmail(user *store.User, failures int64, ip string, lockout time.Duration) {
+	isProd := app.config.env == "prod"
+
+	app.background(func() {
+		data := map[string]any{
+			"Username":  user.Name,
+			"Failures":  failures,
+			"IP":        ip,
+			"LockedFor": lockout.String(),
+			"ResetURL":  fmt.Sprintf("%s/password/forgot", app.config.frontendURL),
+		}
+
+		err := app.mailer.SendAPI(mailer.AccountLockedTemplate, user.Name, user.Email, data, !isProd)
+		if err != nil {
+			app.logger.Error("error sending account locked email", "user_id", user.ID, "error", err)
+		}
+	})
+}
+
+func (app *application) loginLockedResponse(w http.ResponseWriter, r *http.Request, until time.Time) {
+	retryAfter := int64(math.Ceil(time.Until(until).Seconds()))
+	app.rateLimitExceededResponse(w, r, strconv.FormatInt(max(retryAfter, 1), 10))
+}
+
+// loginFailed records the failure and answers the attempt.
+func (app *application) loginFailed(w http.ResponseWriter, r *http.Request, email string, user *store.User, err error) {
+	if err := app.recordLoginFailure(r, email, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.unauthorizedErrorResponse(w, r, err)
+}
+
+func (app *application) unlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// The IPs that failed against the account are likely locked too, and
+	// would keep the owner out just the same.
+	ips, err := app.cache.LoginAttempts.Sources(r.Context(), emailLoginSubject(user.Email))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Lockouts live in the cache, outside any transaction, so the record is
+	// written first: an unlock that can't be audited doesn't happen.
+	if err := app.audit(&app.store, r, "login_account_unlocked", "user", user.ID, nil, map[string]any{"ips": ips}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for _, ip := range ips {
+		if err := app.cache.LoginAttempts.Reset(r.Context(), ipLoginSubject(ip)); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.cache.LoginAttempts.Reset(r.Context(), emailLoginSubject(user.Email)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "user unlocked",
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"newsdrop.org/mailer"
+	"newsdrop.org/store"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+type MagicLinkPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+func (app *application) requestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var payload MagicLinkPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Respond the same way whether or not the email is registered so the
+	// endpoint can't be used to enumerate accounts.
+	response := envelope{
+		"message": "if an account with that email exists, a sign-in link has been sent",
+	}
+
+	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.jsonResponse(w, http.StatusAccepted, response)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Only the latest link works.
+	var token *store.Token
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Tokens.Delete(store.ScopeLogin, user.ID); err != nil {
+			return err
+		}
+		token, err = s.Tokens.New(user.ID, magicLinkTTL, store.ScopeLogin)
+		return err
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	isProd := app.config.env == "prod"
+
+	app.background(func() {
+		data := map[string]any{
+			"Username":  user.Name,
+			"LoginURL":  fmt.Sprintf("%s/login/magic?token=%s", app.config.frontendURL, token.Plaintext),
+			"ExpiresIn": magicLinkTTL.String(),
+		}
+
+		err := app.mailer.SendAPI(mailer.MagicLinkTemplate, user.Name, user.Email, data, !isProd)
+		if err != nil {
+			app.logger.Error("error sending magic link email", "user_id", user.ID, "error", err)
+		}
+	})
+
+	app.jsonResponse(w, http.StatusAccepted, response)
+}
+
+type VerifyMagicLinkPayload struct {
+	Token  string `json:"token" validate:"required,max=64"`
+	Device string `json:"device" validate:"max=100"`
+}
+
+func (app *application) verifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMagicLinkPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	userID, err := app.store.Tokens.Consume(store.ScopeLogin, payload.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// The link proves the user owns the email, which whoever registered the
+	// account never did.
+	if !user.Activated {
+		err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+			return claimUnactivatedAccount(r.Context(), s, user)
+		})
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.cache.Sessions.DeleteByUser(r.Context(), strconv.FormatInt(user.ID, 10)); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if user.MFAEnabled {
+		app.mfaChallenge(w, r, user)
+		return
+	}
+
+	app.startSession(w, r, user, payload.Device)
+}
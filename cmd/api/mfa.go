@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"newsdrop.org/auth"
+	"newsdrop.org/mailer"
+	"newsdrop.org/store"
+	"newsdrop.org/store/cache"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFARequired       = errors.New("two-factor authentication is required for your role")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+)
+
+const mfaPendingEnrollmentCtx contextKey = "mfa_pending_enrollment"
+
+// allowPendingMFAEnrollment lets users whose role requires 2FA reach the
+// enrollment routes before they have set it up.
+func (app *application) allowPendingMFAEnrollment(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), mfaPendingEnrollmentCtx, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func mfaEnrollmentPending(r *http.Request) bool {
+	allowed, _ := r.Context().Value(mfaPendingEnrollmentCtx).(bool)
+	return allowed
+}
+
+func (app *application) mfaChallenge(w http.ResponseWriter, r *http.Request, user *store.User) {
+	if app.rejectSuspended(w, r, user) {
+		return
+	}
+
+	userID := strconv.FormatInt(user.ID, 10)
+
+	challenge, claims, err := app.jwtKeys.IssueMFAChallenge(userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if _, err := app.cache.Ephemeral.SetNX(r.Context(), "mfa:"+claims.ID, userID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":      "two-factor authentication required",
+		"mfa_required": true,
+		"mfa_token":    challenge,
+	})
+}
+
+type LoginMFAPayload struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=20"`
+	Device       string `json:"device" validate:"max=100"`
+}
+
+func (app *application) loginMFA(w http.ResponseWriter, r *http.Request) {
+	var payload LoginMFAPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	claims, err := app.jwtKeys.ParseMFAChallenge(payload.MFAToken)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.cache.Ephemeral.Get(r.Context(), "mfa:"+claims.ID); err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Codes are guessable too, so they share the password lockout.
+	until, err := app.loginLockedUntil(r.Context(), user.Email, clientIP(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !until.IsZero() {
+		app.loginLockedResponse(w, r, until)
+		return
+	}
+
+	if err := app.verifySecondFactor(r.Context(), user, payload.Code, payload.RecoveryCode); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMFACode):
+			app.loginFailed(w, r, user.Email, user, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// The challenge is single use: of two requests racing with a good code,
+	// only the one that takes it gets a session.
+	if _, err := app.cache.Ephemeral.GetDel(r.Context(), "mfa:"+claims.ID); err != nil {
+		switch {
+		case errors.Is(err, cache.ErrCacheMiss):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.cache.LoginAttempts.Reset(r.Context(), emailLoginSubject(user.Email)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.startSession(w, r, user, payload.Device)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code and returns ErrInvalidMFACode for anything else.
+func (app *application) verifySecondFactor(ctx context.Context, user *store.User, code, recoveryCode string) error {
+	if code == "" {
+		err := app.store.MFA.UseRecoveryCode(ctx, user.ID, store.HashRecoveryCode(recoveryCode))
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+
+	totp, err := app.store.MFA.GetTOTP(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+
+	if totp.ConfirmedAt == nil {
+		return ErrInvalidMFACode
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	err = app.store.MFA.UseStep(ctx, user.ID, step)
+	if errors.Is(err, store.ErrConflict) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+func (app *application) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if user.MFAEnabled {
+		app.conflictError(w, r, ErrMFAAlreadyEnabled)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if _, err := app.store.MFA.CreateTOTP(r.Context(), user.ID, secret); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, ErrMFAAlreadyEnabled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message":          "scan the provisioning uri and confirm with a code",
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(secret, mailer.FromName, user.Email),
+	})
+}
+
+type MFACodePayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=20"`
+}
+
+func (app *application) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+
+	user := getUserFromContext(r)
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil || payload.Code == "" {
+		app.badRequestResponse(w, r, errors.New("a totp code is required"))
+		return
+	}
+
+	totp, err := app.store.MFA.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if totp.ConfirmedAt != nil {
+		app.conflictError(w, r, ErrMFAAlreadyEnabled)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, payload.Code, time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, ErrInvalidMFACode)
+		return
+	}
+
+	codes, hashes, err := store.GenerateRecoveryCodes()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.MFA.ConfirmTOTP(r.Context(), user.ID); err != nil {
+			return err
+		}
+		if err := s.MFA.UseStep(r.Context(), user.ID, step); err != nil {
+			return err
+		}
+		return s.MFA.ReplaceRecoveryCodes(r.Context(), user.ID, hashes)
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func (app *application) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+
+	user := getUserFromContext(r)
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !user.MFAEnabled {
+		app.badRequestResponse(w, r, ErrMFANotEnabled)
+		return
+	}
+
+	if user.Role.RequireMFA {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.verifySecondFactor(r.Context(), user, payload.Code, payload.RecoveryCode); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMFACode):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		return s.MFA.DeleteTOTP(r.Context(), user.ID)
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+
+	user := getUserFromContext(r)
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil || payload.Code == "" {
+		app.badRequestResponse(w, r, errors.New("a totp code is required"))
+		return
+	}
+
+	if !user.MFAEnabled {
+		app.badRequestResponse(w, r, ErrMFANotEnabled)
+		return
+	}
+
+	if err := app.verifySecondFactor(r.Context(), user, payload.Code, ""); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMFACode):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	codes, hashes, err := store.GenerateRecoveryCodes()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":        "recovery codes regenerated",
+		"recovery_codes": codes,
+	})
+}
+
+type RoleMFAPayload struct {
+	Required *bool `json:"required" validate:"required"`
+}
+
+func (app *application) setRoleMFA(w http.ResponseWriter, r *http.Request) {
+	var payload RoleMFAPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before, err := app.store.Roles.GetByName(r.Context(), r.PathValue("roleName"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var role *store.Role
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		var err error
+		if role, err = s.Roles.SetRequireMFA(r.Context(), before.Name, *payload.Required); err != nil {
+			return err
+		}
+		return app.audit(s, r, "role_mfa_changed", "role", role.Name, before, role)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "role updated",
+		"role":    role,
+	})
+}
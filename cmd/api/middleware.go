@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
-	"newsdrop.org/auth"
+	"github.com/go-chi/httprate"
 	"newsdrop.org/store"
 )
 
@@ -16,6 +18,74 @@ type contextKey string
 
 const userCtx contextKey = "user"
 const postCtx contextKey = "post"
+const commentCtx contextKey = "comment"
+const sessionCtx contextKey = "session"
+
+// realIP replaces RemoteAddr with the client address from X-Forwarded-For or
+// X-Real-IP, but only when the request came from a trusted proxy. Anyone else
+// could put whatever they like in those headers and dodge the IP rate limits
+// and login lockouts.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := app.forwardedIP(r); ip != "" {
+			r.RemoteAddr = ip
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedIP returns the client address reported by the proxies in front of
+// us, or "" if the peer isn't one of them. Each proxy appends the address it
+// got the request from to X-Forwarded-For, so the client is the last entry
+// that isn't a trusted proxy itself; anything left of it is up to the client.
+func (app *application) forwardedIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !app.isTrustedProxy(peer) {
+		return ""
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+
+		var client netip.Addr
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			client = addr.Unmap()
+			if !app.isTrustedProxy(client) {
+				break
+			}
+		}
+
+		if client.IsValid() {
+			return client.String()
+		}
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+
+	return ""
+}
 
 func bearerFromHeader(r *http.Request) string {
 	h := r.Header.Get("Authorization")
@@ -28,13 +98,42 @@ func bearerFromHeader(r *http.Request) string {
 
 func (app *application) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenStr := bearerFromHeader(r)
+		tokenStr := app.accessTokenFromRequest(r)
 		if tokenStr == "" {
 			app.unauthorizedErrorResponse(w, r, errors.New("missing token"))
 			return
 		}
 
-		claims, err := auth.ParseAccess(tokenStr)
+		if store.IsAccessToken(tokenStr) {
+			user, token, err := app.authenticateAccessToken(r.Context(), tokenStr)
+			if err != nil {
+				switch {
+				case errors.Is(err, store.ErrNotFound):
+					app.unauthorizedErrorResponse(w, r, errors.New("invalid access token"))
+				default:
+					app.internalServerError(w, r, err)
+				}
+				return
+			}
+
+			if app.rejectSuspended(w, r, user) {
+				return
+			}
+
+			// Enrolling takes a session, so a token can't get past this
+			// until its owner signs in and sets up MFA.
+			if user.Role.RequireMFA && !user.MFAEnabled {
+				app.mfaRequiredResponse(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userCtx, user)
+			ctx = context.WithValue(ctx, accessTokenCtx, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		claims, err := app.jwtKeys.ParseAccess(tokenStr)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
@@ -58,11 +157,52 @@ func (app *application) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if app.rejectSuspended(w, r, user) {
+			return
+		}
+
+		if user.Role.RequireMFA && !user.MFAEnabled && !mfaEnrollmentPending(r) {
+			app.mfaRequiredResponse(w, r)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), userCtx, user)
+		ctx = context.WithValue(ctx, sessionCtx, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// requireActivatedUser keeps accounts that haven't confirmed their email, or
+// are waiting to be deleted, from writing anything. Reads are let through.
+func (app *application) requireActivatedUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := getUserFromContext(r)
+		if user == nil {
+			app.unauthorizedErrorResponse(w, r, errors.New("missing user"))
+			return
+		}
+
+		if !user.Activated {
+			app.activationRequiredResponse(w, r)
+			return
+		}
+
+		// Cancelling the deletion, under /users/me, is what lifts this.
+		if user.DeletionScheduledAt != nil {
+			app.deletionPendingResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func MustCookie(w http.ResponseWriter, r *http.Request, name string) (string, error) {
 	val, err := r.Cookie(name)
 	valStr := val.Value
@@ -72,7 +212,7 @@ func MustCookie(w http.ResponseWriter, r *http.Request, name string) (string, er
 	return valStr, nil
 }
 
-func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+func (app *application) checkPostOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := getUserFromContext(r)
 		post := getPostFromContext(r)
@@ -82,26 +222,57 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 			return
 		}
 
-		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		app.requirePermission(permission, next).ServeHTTP(w, r)
+	})
+}
+
+// checkCommentOwnership lets the author of {commentID} through, and anyone
+// else only with the permission. The comment is put in the context.
+func (app *application) checkCommentOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		post := getPostFromContext(r)
+
+		commentID, err := strconv.ParseInt(r.PathValue("commentID"), 10, 64)
 		if err != nil {
-			app.internalServerError(w, r, err)
+			app.badRequestResponse(w, r, err)
 			return
 		}
 
-		if !allowed {
-			app.forbiddenResponse(w, r)
+		comment, err := app.store.Comments.GetByID(r.Context(), commentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if comment.PostID != post.ID {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), commentCtx, comment))
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.requirePermission(permission, next).ServeHTTP(w, r)
 	})
 }
 
-func (app *application) checkResourceAccess(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+// requirePermission lets the request through if the user's role has the
+// named permission.
+func (app *application) requirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := getUserFromContext(r)
 
-		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		allowed, err := app.store.Roles.HasPermission(r.Context(), user.Role.ID, permission)
 		if err != nil {
 			app.internalServerError(w, r, err)
 			return
@@ -116,16 +287,15 @@ func (app *application) checkResourceAccess(requiredRole string, next http.Handl
 	})
 }
 
-func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, rolename string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, rolename)
-	if err != nil {
-		return false, err
-	}
-
-	fmt.Printf("User role: %s (level %d), Required role: %s (level %d)\n",
-		user.Role.Name, user.Role.Level, rolename, role.Level)
-
-	return user.Role.Level >= role.Level, nil
+// limitByIP is a per-route limit on top of the global one for endpoints that
+// send email.
+func (app *application) limitByIP(requests int, window time.Duration) func(http.Handler) http.Handler {
+	return httprate.Limit(requests, window,
+		httprate.WithKeyFuncs(httprate.KeyByIP),
+		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+			app.rateLimitExceededResponse(w, r, strconv.Itoa(int(window.Seconds())))
+		}),
+	)
 }
 
 type LimitType string
@@ -139,22 +309,31 @@ const (
 
 func (app *application) optionalAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var tokenStr string
-
-		cookie, err := r.Cookie("access_token")
-		if err == nil && cookie != nil {
-			tokenStr = cookie.Value
-		}
-
-		if tokenStr == "" {
-			tokenStr = bearerFromHeader(r)
-		}
+		tokenStr := app.accessTokenFromRequest(r)
 		if tokenStr == "" {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		claims, err := auth.ParseAccess(tokenStr)
+		if store.IsAccessToken(tokenStr) {
+			user, token, err := app.authenticateAccessToken(r.Context(), tokenStr)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !app.optionalUserAllowed(r, user) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userCtx, user)
+			ctx = context.WithValue(ctx, accessTokenCtx, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		claims, err := app.jwtKeys.ParseAccess(tokenStr)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
@@ -178,7 +357,22 @@ func (app *application) optionalAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if !app.optionalUserAllowed(r, user) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), userCtx, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// optionalUserAllowed reports whether user may be attached to a request on an
+// optional-auth route. Suspended users, and users whose role requires MFA but
+// who haven't enrolled, keep their credentials but read as anonymous.
+func (app *application) optionalUserAllowed(r *http.Request, user *store.User) bool {
+	if suspension, err := app.activeSuspension(r.Context(), user); err != nil || suspension != nil {
+		return false
+	}
+	return !user.Role.RequireMFA || user.MFAEnabled
+}
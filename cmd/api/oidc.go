@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"newsdrop.org/auth"
+	"newsdrop.org/store"
+	"newsdrop.org/store/cache"
+)
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	ErrInvalidOIDCState    = errors.New("invalid or expired login state")
+	ErrOIDCEmailUnverified = errors.New("identity provider did not return a verified email")
+	ErrOIDCAccountExists   = errors.New("an account with this email already exists, sign in and link the provider to it")
+	ErrIdentityLinked      = errors.New("provider account is already linked")
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcState is what we remember between sending the user to the provider and
+// the provider sending them back.
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Device       string `json:"device"`
+	// LinkUserID is set when a signed-in user is linking the provider to
+	// their account rather than signing in with it.
+	LinkUserID int64 `json:"link_user_id,omitempty"`
+}
+
+func oidcStateKey(state string) string {
+	return "oidc:" + state
+}
+
+func (app *application) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		app.notFoundError(w, r, ErrUnknownOIDCProvider)
+		return
+	}
+
+	app.startOIDC(w, r, provider, oidcState{Device: r.URL.Query().Get("device")})
+}
+
+// linkIdentity starts the same flow as oidcLogin for the signed-in user. The
+// callback then links the provider account to them instead of signing in.
+func (app *application) linkIdentity(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		app.notFoundError(w, r, ErrUnknownOIDCProvider)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	app.startOIDC(w, r, provider, oidcState{LinkUserID: user.ID})
+}
+
+// startOIDC remembers st under a fresh state and returns the provider URL to
+// send the user to.
+func (app *application) startOIDC(w http.ResponseWriter, r *http.Request, provider *auth.OIDCProvider, st oidcState) {
+	state, err := auth.NewOIDCState()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nonce, err := auth.NewOIDCState()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	st.Provider = provider.Name()
+	st.Nonce = nonce
+	st.CodeVerifier = verifier
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if _, err := app.cache.Ephemeral.SetNX(r.Context(), oidcStateKey(state), string(data), oidcStateTTL); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":           "redirect to the identity provider",
+		"authorization_url": authURL,
+	})
+}
+
+type OIDCCallbackPayload struct {
+	Code  string `json:"code" validate:"required,max=2048"`
+	State string `json:"state" validate:"required,max=255"`
+}
+
+func (app *application) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	var payload OIDCCallbackPayload
+
+	provider, ok := app.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		app.notFoundError(w, r, ErrUnknownOIDCProvider)
+		return
+	}
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// A state is good for one attempt.
+	data, err := app.cache.Ephemeral.GetDel(r.Context(), oidcStateKey(payload.State))
+	if err != nil {
+		switch {
+		case errors.Is(err, cache.ErrCacheMiss):
+			app.badRequestResponse(w, r, ErrInvalidOIDCState)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var state oidcState
+	if err := json.Unmarshal([]byte(data), &state); err != nil || state.Provider != provider.Name() {
+		app.badRequestResponse(w, r, ErrInvalidOIDCState)
+		return
+	}
+
+	// A link has to be finished by the user who started it, or anyone
+	// holding the state could attach their provider account to them.
+	var linkUser *store.User
+	if state.LinkUserID != 0 {
+		linkUser = getUserFromContext(r)
+		if linkUser == nil || linkUser.ID != state.LinkUserID {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	claims, err := provider.Exchange(r.Context(), payload.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	if linkUser != nil {
+		app.completeIdentityLink(w, r, provider, linkUser, claims)
+		return
+	}
+
+	user, err := app.resolveOIDCUser(r.Context(), provider, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrOIDCEmailUnverified):
+			app.forbiddenResponse(w, r)
+		case errors.Is(err, ErrOIDCAccountExists):
+			app.oidcAccountExistsResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.MFAEnabled {
+		app.mfaChallenge(w, r, user)
+		return
+	}
+
+	app.startSession(w, r, user, state.Device)
+}
+
+func (app *application) completeIdentityLink(w http.ResponseWriter, r *http.Request, provider *auth.OIDCProvider, user *store.User, claims *auth.IDTokenClaims) {
+	identity := &store.Identity{
+		UserID:   user.ID,
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	if err := app.store.Identities.Create(r.Context(), identity); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			app.conflictError(w, r, ErrIdentityLinked)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logSecurityEvent(r, "identity_linked", "user_id", user.ID, "provider", provider.Name())
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message":  "identity linked",
+		"identity": identity,
+	})
+}
+
+// resolveOIDCUser returns the user linked to the provider account. An
+// unlinked account gets a new user with the default role. If the email is
+// already taken, it is linked to that user when nobody has activated it yet
+// or the provider is trusted for email; otherwise the owner has to sign in
+// and link the provider themselves.
+func (app *application) resolveOIDCUser(ctx context.Context, provider *auth.OIDCProvider, claims *auth.IDTokenClaims) (*store.User, error) {
+	identity, err := app.store.Identities.GetBySubject(ctx, provider.Name(), claims.Subject)
+	if err == nil {
+		return app.store.Users.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailUnverified
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, claims.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if user != nil && user.Activated && !provider.TrustsEmail() {
+		return nil, ErrOIDCAccountExists
+	}
+
+	claimed := user != nil && !user.Activated
+
+	err = app.store.WithTx(ctx, func(s *store.Storage) error {
+		switch {
+		case user == nil:
+			user, err = app.newOIDCUser(ctx, s, claims)
+			if err != nil {
+				return err
+			}
+		case !user.Activated:
+			// Whoever registered this email never proved they own it; the
+			// provider just did.
+			if err := claimUnactivatedAccount(ctx, s, user); err != nil {
+				return err
+			}
+		}
+
+		return s.Identities.Create(ctx, &store.Identity{
+			UserID:   user.ID,
+			Provider: provider.Name(),
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claimed {
+		if err := app.cache.Sessions.DeleteByUser(ctx, strconv.FormatInt(user.ID, 10)); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// claimUnactivatedAccount hands an account over to whoever just proved they
+// own its email. The account was registered by someone who never did, so
+// everything that lets them in goes: the password, access tokens, pending
+// tokens, linked identities and any 2FA they set up, which could otherwise
+// lock the owner out. Their sessions live in the cache and have to be
+// dropped by the caller once the transaction commits.
+func claimUnactivatedAccount(ctx context.Context, s *store.Storage, user *store.User) error {
+	user.Activated = true
+	if err := user.Password.Set(randomPassword()); err != nil {
+		return err
+	}
+	if err := s.Users.Update(user); err != nil {
+		return err
+	}
+
+	if err := s.AccessTokens.DeleteByUser(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.Tokens.DeleteByUser(user.ID); err != nil {
+		return err
+	}
+	if err := s.Identities.DeleteByUser(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.MFA.DeleteTOTP(ctx, user.ID); err != nil {
+		return err
+	}
+	user.MFAEnabled = false
+
+	return nil
+}
+
+func (app *application) newOIDCUser(ctx context.Context, s *store.Storage, claims *auth.IDTokenClaims) (*store.User, error) {
+	name, err := app.availableUsername(ctx, s, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := claims.Name
+	if runes := []rune(displayName); len(runes) > 30 {
+		displayName = string(runes[:30])
+	}
+
+	user := &store.User{
+		Name:        name,
+		DisplayName: displayName,
+		Email:       claims.Email,
+		Activated:   true,
+		Role:        *app.defaultRole,
+	}
+
+	// OIDC users sign in through their provider; they can set a password
+	// with the reset flow if they want one.
+	if err := user.Password.Set(randomPassword()); err != nil {
+		return nil, err
+	}
+
+	if err := s.Users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// Create doesn't return the role.
+	user.Role = *app.defaultRole
+
+	return user, nil
+}
+
+// availableUsername derives a username from the ID token and adds a random
+// suffix until it is free.
+func (app *application) availableUsername(ctx context.Context, s *store.Storage, claims *auth.IDTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return -1
+		}
+	}, base)
+	if len(base) < 2 {
+		base = "user"
+	}
+	if len(base) > 24 {
+		base = base[:24]
+	}
+
+	name := base
+	for range 5 {
+		_, err := s.Users.GetByName(ctx, name)
+		if errors.Is(err, store.ErrNotFound) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		suffix := make([]byte, 2)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		name = base + "_" + hex.EncodeToString(suffix)
+	}
+
+	return "", ErrDuplicateName
+}
+
+func randomPassword() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (app *application) listIdentities(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	identities, err := app.store.Identities.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":    "success",
+		"identities": identities,
+	})
+}
@@ -8,11 +8,11 @@ import (
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"newsdrop.org/store"
 )
@@ -62,7 +62,12 @@ func (app *application) createPost(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return err
 		}
-		return nil
+		return s.PostRevisions.Create(r.Context(), &store.PostRevision{
+			PostID:   post.ID,
+			Title:    title,
+			Content:  content,
+			EditorID: &user.ID,
+		})
 	})
 	if err != nil {
 		app.internalServerError(w, r, err)
@@ -106,11 +111,16 @@ func (app *application) getPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if post.HiddenAt != nil {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
 	fileLinks := make([]string, 0, len(post.FileIDs))
 	fmt.Printf("len(post.FileIDs): %v\n", len(post.FileIDs))
 
 	for i := range post.FileIDs {
-		publicLink, err := app.storage.GetFromR2(r.Context(), fmt.Sprintf("%s%s", post.FileIDs[i], post.FileExtensions[i]))
+		publicLink, err := app.storage.GetURL(r.Context(), fmt.Sprintf("%s%s", post.FileIDs[i], post.FileExtensions[i]))
 		if err != nil {
 			app.internalServerError(w, r, err)
 			return
@@ -151,13 +161,20 @@ func (app *application) getPostByUserID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Authors still see their hidden posts; everyone else doesn't.
+	if userID != getUserFromContext(r).ID {
+		posts = slices.DeleteFunc(posts, func(post *store.Post) bool {
+			return post.HiddenAt != nil
+		})
+	}
+
 	allFileLinks := make(map[int64]map[string]string)
 
 	for _, post := range posts {
 		if len(post.FileIDs) > 0 {
 			fileLinks := make(map[string]string, len(post.FileIDs))
 			for i := range post.FileIDs {
-				publicLink, err := app.storage.GetFromR2(r.Context(), fmt.Sprintf("%s%s", post.FileIDs[i], post.FileExtensions[i]))
+				publicLink, err := app.storage.GetURL(r.Context(), fmt.Sprintf("%s%s", post.FileIDs[i], post.FileExtensions[i]))
 				if err != nil {
 					app.internalServerError(w, r, err)
 					return
@@ -177,14 +194,25 @@ func (app *application) getPostByUserID(w http.ResponseWriter, r *http.Request)
 
 func (app *application) updatePost(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromContext(r)
+	// A copy, so the audit log sees the post as it was whatever happens to
+	// post below.
+	before := *post
 
 	if err := r.ParseMultipartForm(maxFormSize); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	// A field left out keeps its current value.
+	title := r.PostFormValue("title")
+	if title == "" {
+		title = post.Title
+	}
 	content := r.PostFormValue("content")
-	if err := Validate.Struct(PostForm{Content: content}); err != nil {
+	if content == "" {
+		content = post.Content
+	}
+	if err := Validate.Struct(PostForm{Title: title, Content: content}); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
@@ -202,16 +230,42 @@ func (app *application) updatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var err error
-	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		post, err = s.Posts.Update(r.Context(), content, post.ID)
+	user := getUserFromContext(r)
+	// Someone else editing the post is a moderator, and goes in the audit log
+	// with whichever change comes first.
+	audited := before.UserID == user.ID
+
+	// Only text changes make a revision; swapping files doesn't.
+	if title != before.Title || content != before.Content {
+		err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+			post, err = s.Posts.Update(r.Context(), title, content, post.ID)
+			if err != nil {
+				return err
+			}
+			err = s.PostRevisions.Create(r.Context(), &store.PostRevision{
+				PostID:   post.ID,
+				Title:    title,
+				Content:  content,
+				EditorID: &user.ID,
+			})
+			if err != nil {
+				return err
+			}
+			if !audited {
+				return app.audit(s, r, "post_updated", "post", post.ID, &before, post)
+			}
+			return nil
+		})
 		if err != nil {
-			return err
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
 		}
-		return nil
-	})
-	if err != nil {
-		app.internalServerError(w, r, err)
-		return
+		audited = true
 	}
 
 	var postFileRecords []any
@@ -244,23 +298,29 @@ func (app *application) updatePost(w http.ResponseWriter, r *http.Request) {
 			filenames = append(filenames, filename)
 		}
 
-		for _, val := range oldPostFiles {
-			err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-				err = app.store.PostFiles.Delete(r.Context(), val.FileID)
+		err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+			for _, val := range oldPostFiles {
+				if err := s.PostFiles.Delete(r.Context(), val.FileID); err != nil {
+					return err
+				}
+			}
+			if !audited {
+				after, err := s.Posts.GetByID(r.Context(), post.ID)
 				if err != nil {
 					return err
 				}
-				return nil
-			})
-			if err != nil {
-				app.cleanupUploadedFiles(r.Context(), filenames)
-				app.internalServerError(w, r, err)
-				return
+				return app.audit(s, r, "post_updated", "post", post.ID, &before, after)
 			}
+			return nil
+		})
+		if err != nil {
+			app.cleanupUploadedFiles(r.Context(), filenames)
+			app.internalServerError(w, r, err)
+			return
 		}
 
 		for _, val := range oldPostFiles {
-			err := app.storage.DeleteFromR2(r.Context(), fmt.Sprintf("%s%s", val.FileID, val.FileExtension))
+			err := app.storage.Delete(r.Context(), fmt.Sprintf("%s%s", val.FileID, val.FileExtension))
 			if err != nil {
 				app.logger.Error("failed to delete old file", "error", err)
 			}
@@ -291,55 +351,29 @@ func (app *application) updatePost(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) deletePost(w http.ResponseWriter, r *http.Request) {
-	postIDStr := r.PathValue("postID")
-	postID, err := strconv.Atoi(postIDStr)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
+	post := getPostFromContext(r)
 
-	var postFiles []*store.PostFile
-	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		postFiles, err = app.store.PostFiles.GetByPostID(r.Context(), int64(postID))
-		if err != nil {
+	user := getUserFromContext(r)
+
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Posts.Delete(r.Context(), post.ID, user.ID); err != nil {
 			return err
 		}
+		if post.UserID != user.ID {
+			return app.audit(s, r, "post_deleted", "post", post.ID, post, nil)
+		}
 		return nil
 	})
 	if err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
-
-	for _, val := range postFiles {
-		err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-
-			err = app.store.PostFiles.Delete(r.Context(), val.FileID)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
-		if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
 			app.internalServerError(w, r, err)
-			return
 		}
-
-	}
-
-	if err = app.store.Posts.Delete(r.Context(), int64(postID)); err != nil {
-		app.internalServerError(w, r, err)
 		return
 	}
 
-	for _, val := range postFiles {
-		err := app.storage.DeleteFromR2(r.Context(), fmt.Sprintf("%s%s", val.FileID, val.FileExtension))
-		if err != nil {
-			app.internalServerError(w, r, err)
-			return
-		}
-	}
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -392,7 +426,7 @@ func (app *application) processFileUpload(ctx context.Context, fileHeader *multi
 	fileExt := filepath.Ext(fileHeader.Filename)
 	filename := fmt.Sprintf("%s%s", fileID.String(), fileExt)
 
-	if err := app.storage.SaveToR2(ctx, file, fileExt, filename); err != nil {
+	if err := app.storage.Save(ctx, file, fileExt, filename); err != nil {
 		return nil, "", err
 	}
 
@@ -413,7 +447,7 @@ func (app *application) processFileUpload(ctx context.Context, fileHeader *multi
 
 func (app *application) cleanupUploadedFiles(ctx context.Context, filenames []string) {
 	for _, val := range filenames {
-		_ = app.storage.DeleteFromR2(ctx, val)
+		_ = app.storage.Delete(ctx, val)
 	}
 }
 
@@ -432,8 +466,8 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 
 		post, err := app.store.Posts.GetByID(r.Context(), postID)
 		if err != nil {
-			switch err {
-			case pgx.ErrNoRows:
+			switch {
+			case errors.Is(err, store.ErrNotFound):
 				app.notFoundError(w, r, err)
 			default:
 				app.internalServerError(w, r, err)
@@ -441,6 +475,12 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// A hidden post is off limits until a moderator unhides it.
+		if post.HiddenAt != nil {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -517,12 +557,12 @@ func (app *application) uploadPostFiles(w http.ResponseWriter, r *http.Request)
 	fileExt := filepath.Ext(fileHeader.Filename)
 	filename := fmt.Sprintf("%s%s", fileID.String(), fileExt)
 
-	if err := app.storage.SaveToR2(r.Context(), file, fileExt, filename); err != nil {
+	if err := app.storage.Save(r.Context(), file, fileExt, filename); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	link, err := app.storage.GetFromR2(r.Context(), filename)
+	link, err := app.storage.GetURL(r.Context(), filename)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"newsdrop.org/store"
+)
+
+var (
+	ErrSelfReport         = errors.New("you can't report your own content")
+	ErrDuplicateReport    = errors.New("you already reported this")
+	ErrReportClosed       = errors.New("report is already closed")
+	ErrAssigneeNotAllowed = errors.New("assignee can't moderate reports")
+	ErrActionNotAllowed   = errors.New("you can't take this action on the reported content")
+)
+
+const reportsPageSize = 50
+
+type ReportPayload struct {
+	Reason  string `json:"reason" validate:"required,oneof=spam harassment hate violence sexual misinformation other"`
+	Details string `json:"details" validate:"max=1000"`
+}
+
+func (app *application) reportPost(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	app.createReport(w, r, store.ReportTargetPost, post.ID, post.ID, post.UserID)
+}
+
+func (app *application) reportComment(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	commentID, err := strconv.ParseInt(r.PathValue("commentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment, err := app.store.Comments.GetByID(r.Context(), commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if comment.PostID != post.ID || comment.HiddenAt != nil {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	app.createReport(w, r, store.ReportTargetComment, comment.ID, post.ID, comment.UserID)
+}
+
+func (app *application) createReport(w http.ResponseWriter, r *http.Request, targetType string, targetID, postID, authorID int64) {
+	var payload ReportPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if authorID == user.ID {
+		app.badRequestResponse(w, r, ErrSelfReport)
+		return
+	}
+
+	report := &store.Report{
+		ReporterID: &user.ID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		PostID:     postID,
+		Reason:     payload.Reason,
+		Details:    payload.Details,
+	}
+
+	if err := app.store.Reports.Create(r.Context(), report); err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_reports_reporter_target":
+			app.conflictError(w, r, ErrDuplicateReport)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message": "thanks, a moderator will review it",
+		"report":  report,
+	})
+}
+
+type ListReportsQuery struct {
+	Status     string `validate:"omitempty,oneof=open assigned resolved dismissed"`
+	TargetType string `validate:"omitempty,oneof=post comment"`
+	Page       int64  `validate:"min=1"`
+}
+
+func (app *application) listReports(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	query := ListReportsQuery{
+		Status:     q.Get("status"),
+		TargetType: q.Get("type"),
+		Page:       1,
+	}
+
+	if pageStr := q.Get("page"); pageStr != "" {
+		page, err := strconv.ParseInt(pageStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.Page = page
+	}
+
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// ?assignee=me narrows the queue to what the moderator picked up.
+	var assigneeID *int64
+	if q.Get("assignee") == "me" {
+		assigneeID = &getUserFromContext(r).ID
+	}
+
+	total, reports, err := app.store.Reports.List(r.Context(), query.Status, query.TargetType, assigneeID, reportsPageSize, (query.Page-1)*reportsPageSize)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "success",
+		"page":    query.Page,
+		"total":   total,
+		"reports": reports,
+	})
+}
+
+// getReportFromPath loads {reportID} and answers the request itself when it
+// can't.
+func (app *application) getReportFromPath(w http.ResponseWriter, r *http.Request) (*store.Report, bool) {
+	reportID, err := strconv.ParseInt(r.PathValue("reportID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	report, err := app.store.Reports.GetByID(r.Context(), reportID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return report, true
+}
+
+func (app *application) getReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := app.getReportFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// The target is nil once it has been deleted.
+	var target any
+	var err error
+	switch report.TargetType {
+	case store.ReportTargetPost:
+		target, err = app.store.Posts.GetByID(r.Context(), report.TargetID)
+	case store.ReportTargetComment:
+		target, err = app.store.Comments.GetByID(r.Context(), report.TargetID)
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "success",
+		"report":  report,
+		"target":  target,
+	})
+}
+
+type AssignReportPayload struct {
+	// AssigneeID defaults to the moderator making the request.
+	AssigneeID *int64 `json:"assignee_id"`
+}
+
+func (app *application) assignReport(w http.ResponseWriter, r *http.Request) {
+	var payload AssignReportPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	assignee := user
+
+	if payload.AssigneeID != nil && *payload.AssigneeID != user.ID {
+		var err error
+		assignee, err = app.store.Users.GetByID(r.Context(), *payload.AssigneeID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.badRequestResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		allowed, err := app.store.Roles.HasPermission(r.Context(), assignee.Role.ID, store.PermReportModerate)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.badRequestResponse(w, r, ErrAssigneeNotAllowed)
+			return
+		}
+	}
+
+	before, ok := app.getReportFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var report *store.Report
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		var err error
+		if report, err = s.Reports.Assign(r.Context(), before.ID, assignee.ID); err != nil {
+			return err
+		}
+		return app.audit(s, r, "report_assigned", "report", report.ID, before, report)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, ErrReportClosed)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "report assigned",
+		"report":  report,
+	})
+}
+
+type ResolveReportPayload struct {
+	Action string `json:"action" validate:"required,oneof=none hide delete"`
+	Note   string `json:"note" validate:"max=1000"`
+}
+
+func (app *application) resolveReport(w http.ResponseWriter, r *http.Request) {
+	var payload ResolveReportPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before, ok := app.getReportFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if before.Status == store.ReportResolved || before.Status == store.ReportDismissed {
+		app.conflictError(w, r, ErrReportClosed)
+		return
+	}
+
+	var report *store.Report
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := app.actOnReportTarget(s, r, before, payload.Action); err != nil {
+			return err
+		}
+
+		if err := s.Reports.Resolve(r.Context(), before, getUserFromContext(r).ID, payload.Action, payload.Note); err != nil {
+			return err
+		}
+
+		var err error
+		if report, err = s.Reports.GetByID(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		return app.audit(s, r, "report_resolved", "report", report.ID, before, report)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrActionNotAllowed):
+			app.forbiddenResponse(w, r)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, ErrReportClosed)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "report resolved",
+		"report":  report,
+	})
+}
+
+// actOnReportTarget hides or deletes what was reported and audits the change.
+// Moderating reports doesn't by itself let someone remove content: that takes
+// the same permission as deleting the post or comment directly. A target that
+// is already gone is fine; whoever removed it is on record for that. s is the
+// transaction that resolves the report.
+func (app *application) actOnReportTarget(s *store.Storage, r *http.Request, report *store.Report, action string) error {
+	if action == store.ReportActionNone {
+		return nil
+	}
+
+	ctx := r.Context()
+
+	permission := store.PermPostDeleteAny
+	if report.TargetType == store.ReportTargetComment {
+		permission = store.PermCommentModerate
+	}
+
+	allowed, err := s.Roles.HasPermission(ctx, getUserFromContext(r).Role.ID, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrActionNotAllowed
+	}
+
+	var before, after any
+
+	switch report.TargetType {
+	case store.ReportTargetPost:
+		var post *store.Post
+		if post, err = s.Posts.GetByID(ctx, report.TargetID); err != nil {
+			break
+		}
+		before = post
+
+		switch action {
+		case store.ReportActionHide:
+			if err = s.Posts.Hide(ctx, post.ID); err == nil {
+				after, err = s.Posts.GetByID(ctx, post.ID)
+			}
+		case store.ReportActionDelete:
+			err = s.Posts.Delete(ctx, post.ID, getUserFromContext(r).ID)
+		}
+	case store.ReportTargetComment:
+		var comment *store.Comment
+		if comment, err = s.Comments.GetByID(ctx, report.TargetID); err != nil {
+			break
+		}
+		before = comment
+
+		switch action {
+		case store.ReportActionHide:
+			if err = s.Comments.Hide(ctx, comment.ID); err == nil {
+				after, err = s.Comments.GetByID(ctx, comment.ID)
+			}
+		case store.ReportActionDelete:
+			err = s.Comments.Delete(ctx, comment.ID, getUserFromContext(r).ID)
+		}
+	}
+
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := "hidden"
+	if action == store.ReportActionDelete {
+		verb = "deleted"
+	}
+	return app.audit(s, r, report.TargetType+"_"+verb, report.TargetType, report.TargetID, before, after)
+}
+
+type DismissReportPayload struct {
+	Note string `json:"note" validate:"max=1000"`
+}
+
+func (app *application) dismissReport(w http.ResponseWriter, r *http.Request) {
+	var payload DismissReportPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report, ok := app.getReportFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		dismissed, err := s.Reports.Dismiss(r.Context(), report.ID, getUserFromContext(r).ID, payload.Note)
+		if err != nil {
+			return err
+		}
+		return app.audit(s, r, "report_dismissed", "report", report.ID, report, dismissed)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, ErrReportClosed)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unhidePost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before, err := app.store.Posts.GetByID(r.Context(), postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	var post *store.Post
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Posts.Unhide(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		var err error
+		if post, err = s.Posts.GetByID(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		return app.audit(s, r, "post_unhidden", "post", post.ID, before, post)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "post unhidden",
+		"post":    post,
+	})
+}
+
+func (app *application) unhideComment(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	commentID, err := strconv.ParseInt(r.PathValue("commentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before, err := app.store.Comments.GetByID(r.Context(), commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if before.PostID != post.ID {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	var comment *store.Comment
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Comments.Unhide(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		var err error
+		if comment, err = s.Comments.GetByID(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		return app.audit(s, r, "comment_unhidden", "comment", comment.ID, before, comment)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "comment unhidden",
+		"comment": comment,
+	})
+}
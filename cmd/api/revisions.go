@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"newsdrop.org/store"
+	"newsdrop.org/textdiff"
+)
+
+var ErrNoPreviousRevision = errors.New("post has not been edited")
+
+func (app *application) listPostRevisions(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	revisions, err := app.store.PostRevisions.List(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":   "success",
+		"revisions": revisions,
+	})
+}
+
+type RevisionDiffQuery struct {
+	From int64 `validate:"min=1"`
+	To   int64 `validate:"min=1,nefield=From"`
+}
+
+// diffPostRevisions compares ?from= with ?to=. Without them it shows the
+// latest edit: to is the newest revision and from the one before it.
+func (app *application) diffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	q := r.URL.Query()
+	var query RevisionDiffQuery
+
+	if toStr := q.Get("to"); toStr != "" {
+		to, err := strconv.ParseInt(toStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.To = to
+	} else {
+		revisions, err := app.store.PostRevisions.List(r.Context(), post.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if len(revisions) < 2 {
+			app.notFoundError(w, r, ErrNoPreviousRevision)
+			return
+		}
+		query.To = revisions[0].Revision
+	}
+
+	query.From = query.To - 1
+	if fromStr := q.Get("from"); fromStr != "" {
+		from, err := strconv.ParseInt(fromStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.From = from
+	}
+
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	from, err := app.store.PostRevisions.Get(r.Context(), post.ID, query.From)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	to, err := app.store.PostRevisions.Get(r.Context(), post.ID, query.To)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "success",
+		"from":    from,
+		"to":      to,
+		"title":   textdiff.Words(from.Title, to.Title),
+		"content": textdiff.Words(from.Content, to.Content),
+	})
+}
+
+// redactPostRevision blanks one revision of the post. The history keeps the
+// revision and who made it; only the text goes.
+func (app *application) redactPostRevision(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	number, err := strconv.ParseInt(r.PathValue("revision"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before, err := app.store.PostRevisions.Get(r.Context(), post.ID, number)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	var revision *store.PostRevision
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.PostRevisions.Redact(r.Context(), post.ID, number, user.ID); err != nil {
+			return err
+		}
+
+		var err error
+		if revision, err = s.PostRevisions.Get(r.Context(), post.ID, number); err != nil {
+			return err
+		}
+
+		return app.audit(s, r, "post_revision_redacted", "post", post.ID, before, revision)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":  "revision redacted",
+		"revision": revision,
+	})
+}
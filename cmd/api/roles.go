@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"newsdrop.org/store"
+)
+
+var (
+	ErrDuplicateRole     = errors.New("role already exists")
+	ErrRoleManageLockout = errors.New("you can't remove role.manage from your own role")
+	ErrLastRoleManager   = errors.New("someone has to keep role.manage")
+)
+
+func (app *application) listRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Roles.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "success",
+		"roles":   roles,
+	})
+}
+
+func (app *application) listPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.store.Permissions.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":     "success",
+		"permissions": permissions,
+	})
+}
+
+type CreateRolePayload struct {
+	Name        string   `json:"name" validate:"required,min=2,max=50,lowercase,alphanum"`
+	Description string   `json:"description" validate:"max=255"`
+	Permissions []string `json:"permissions" validate:"max=50,dive,max=100"`
+}
+
+func (app *application) createRole(w http.ResponseWriter, r *http.Request) {
+	var payload CreateRolePayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	role := &store.Role{
+		Name:        payload.Name,
+		Description: payload.Description,
+	}
+
+	err := app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Roles.Create(r.Context(), role); err != nil {
+			return err
+		}
+		if err := s.Roles.SetPermissions(r.Context(), role.ID, payload.Permissions); err != nil {
+			return err
+		}
+
+		var err error
+		if role, err = s.Roles.GetByName(r.Context(), role.Name); err != nil {
+			return err
+		}
+
+		return app.audit(s, r, "role_created", "role", role.Name, nil, role)
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestResponse(w, r, err)
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "roles_name_key":
+			app.conflictError(w, r, ErrDuplicateRole)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message": "role created",
+		"role":    role,
+	})
+}
+
+type RolePermissionsPayload struct {
+	Permissions []string `json:"permissions" validate:"max=50,dive,max=100"`
+}
+
+func (app *application) setRolePermissions(w http.ResponseWriter, r *http.Request) {
+	var payload RolePermissionsPayload
+
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	role, err := app.store.Roles.GetByName(r.Context(), r.PathValue("roleName"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Otherwise the last person able to manage roles could lock everyone out.
+	if role.ID == user.Role.ID && !slices.Contains(payload.Permissions, store.PermRoleManage) {
+		app.badRequestResponse(w, r, ErrRoleManageLockout)
+		return
+	}
+
+	before := role
+
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Roles.SetPermissions(r.Context(), role.ID, payload.Permissions); err != nil {
+			return err
+		}
+
+		var err error
+		if role, err = s.Roles.GetByName(r.Context(), role.Name); err != nil {
+			return err
+		}
+
+		return app.audit(s, r, "role_permissions_changed", "role", role.Name, before, role)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "role updated",
+		"role":    role,
+	})
+}
+
+func (app *application) deleteRole(w http.ResponseWriter, r *http.Request) {
+	role, err := app.store.Roles.GetByName(r.Context(), r.PathValue("roleName"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Roles.Delete(r.Context(), role.Name); err != nil {
+			return err
+		}
+		return app.audit(s, r, "role_deleted", "role", role.Name, role, nil)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrSystemRole), errors.Is(err, store.ErrRoleInUse):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const searchPageSize = 20
+
+type SearchQuery struct {
+	Q    string `validate:"required,min=1,max=256"`
+	Type string `validate:"oneof=posts users tags"`
+	Page int64  `validate:"min=1"`
+}
+
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	query := SearchQuery{
+		Q:    r.URL.Query().Get("q"),
+		Type: r.URL.Query().Get("type"),
+		Page: 1,
+	}
+
+	if query.Type == "" {
+		query.Type = "posts"
+	}
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		page, err := strconv.ParseInt(pageStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		query.Page = page
+	}
+
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var total int64
+	var results any
+	var err error
+	offset := (query.Page - 1) * searchPageSize
+
+	switch query.Type {
+	case "posts":
+		total, results, err = app.store.Posts.Search(r.Context(), query.Q, searchPageSize, offset)
+	case "users":
+		total, results, err = app.store.Users.Search(r.Context(), query.Q, searchPageSize, offset)
+	case "tags":
+		total, results, err = app.store.Tags.Search(r.Context(), query.Q, searchPageSize, offset)
+	}
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "success",
+		"type":    query.Type,
+		"page":    query.Page,
+		"total":   total,
+		"results": results,
+	})
+}
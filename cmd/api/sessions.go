@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"newsdrop.org/store/cache"
+)
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func newSession(r *http.Request, userID int64, device string) *cache.Session {
+	userAgent := r.UserAgent()
+	if device == "" {
+		device = deviceFromUserAgent(userAgent)
+	}
+
+	return &cache.Session{
+		ID:        uuid.NewString(),
+		UserID:    strconv.FormatInt(userID, 10),
+		Device:    device,
+		IP:        clientIP(r),
+		UserAgent: userAgent,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// clientIP returns the caller's address. realIP has already replaced
+// RemoteAddr with the one a trusted proxy reported, if any.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case strings.Contains(ua, "iphone"):
+		return "iPhone"
+	case strings.Contains(ua, "ipad"):
+		return "iPad"
+	case strings.Contains(ua, "android"):
+		return "Android"
+	case strings.Contains(ua, "windows"):
+		return "Windows"
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os"):
+		return "Mac"
+	case strings.Contains(ua, "linux"):
+		return "Linux"
+	default:
+		return "Unknown device"
+	}
+}
+
+func getSessionIDFromContext(r *http.Request) string {
+	sessionID, _ := r.Context().Value(sessionCtx).(string)
+	return sessionID
+}
+
+func (app *application) listSessions(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	currentID := getSessionIDFromContext(r)
+
+	sessions, err := app.cache.Sessions.ListSessions(r.Context(), strconv.FormatInt(user.ID, 10))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, sessionResponse{
+			ID:         s.ID,
+			Device:     s.Device,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentID,
+		})
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":  "success",
+		"sessions": response,
+	})
+}
+
+func (app *application) revokeSession(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	session, err := app.cache.Sessions.GetSession(r.Context(), r.PathValue("sessionID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, cache.ErrCacheMiss):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Don't reveal whether another user's session ID exists.
+	if session.UserID != strconv.FormatInt(user.ID, 10) {
+		app.notFoundError(w, r, cache.ErrCacheMiss)
+		return
+	}
+
+	if err := app.cache.Sessions.DeleteSession(r.Context(), session); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if session.ID == getSessionIDFromContext(r) {
+		app.clearAuthCookies(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if err := app.cache.Sessions.DeleteByUser(r.Context(), strconv.FormatInt(user.ID, 10)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
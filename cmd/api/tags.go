@@ -29,11 +29,11 @@ func (app *application) createTag(w http.ResponseWriter, r *http.Request) {
 	var tag *store.Tag
 	var err error
 	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		tag, err = app.store.Tags.Create(r.Context(), payload.Name)
+		tag, err = s.Tags.Create(r.Context(), payload.Name)
 		if err != nil {
 			return err
 		}
-		return nil
+		return app.audit(s, r, "tag_created", "tag", tag.ID, nil, tag)
 	})
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -89,15 +89,31 @@ func (app *application) deleteTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tag, err := app.store.Tags.GetByID(r.Context(), tagID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
 	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		err = app.store.Tags.Delete(r.Context(), tagID)
+		err = s.Tags.Delete(r.Context(), tagID)
 		if err != nil {
 			return err
 		}
-		return nil
+		return app.audit(s, r, "tag_deleted", "tag", tag.ID, tag, nil)
 	})
 	if err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"newsdrop.org/store"
+)
+
+func (app *application) listTrash(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	posts, err := app.store.Posts.ListDeleted(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	comments, err := app.store.Comments.ListDeleted(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message":        "success",
+		"posts":          posts,
+		"comments":       comments,
+		"retention_days": int(app.config.trashRetention.Hours() / 24),
+	})
+}
+
+// mayRestore reports whether the user can take something out of the trash.
+// Authors can restore what they deleted themselves; what a moderator deleted
+// takes the permission to bring back.
+func (app *application) mayRestore(ctx context.Context, user *store.User, authorID int64, deletedBy *int64, permission string) (bool, error) {
+	if authorID == user.ID && deletedBy != nil && *deletedBy == user.ID {
+		return true, nil
+	}
+	return app.store.Roles.HasPermission(ctx, user.Role.ID, permission)
+}
+
+func (app *application) restorePost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before, err := app.store.Posts.GetDeleted(r.Context(), postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	allowed, err := app.mayRestore(r.Context(), user, before.UserID, before.DeletedBy, store.PermPostDeleteAny)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var post *store.Post
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Posts.Restore(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		var err error
+		if post, err = s.Posts.GetByID(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		if before.UserID != user.ID {
+			return app.audit(s, r, "post_restored", "post", post.ID, before, post)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "post restored",
+		"post":    post,
+	})
+}
+
+func (app *application) restoreComment(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	commentID, err := strconv.ParseInt(r.PathValue("commentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before, err := app.store.Comments.GetDeleted(r.Context(), commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if before.PostID != post.ID {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	allowed, err := app.mayRestore(r.Context(), user, before.UserID, before.DeletedBy, store.PermCommentModerate)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var comment *store.Comment
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		if err := s.Comments.Restore(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		var err error
+		if comment, err = s.Comments.GetByID(r.Context(), before.ID); err != nil {
+			return err
+		}
+
+		if before.UserID != user.ID {
+			return app.audit(s, r, "comment_restored", "comment", comment.ID, before, comment)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, envelope{
+		"message": "comment restored",
+		"comment": comment,
+	})
+}
+
+// purgeTrash removes posts and comments that have been in the trash for
+// longer than the retention period.
+func (app *application) purgeTrash(ctx context.Context) {
+	before := time.Now().Add(-app.config.trashRetention)
+
+	postIDs, err := app.store.Posts.ListDeletedBefore(ctx, before, purgeBatchSize)
+	if err != nil {
+		app.logger.Error("error listing expired posts", "error", err)
+	} else {
+		for _, postID := range postIDs {
+			if err := app.purgePost(ctx, postID); err != nil {
+				app.logger.Error("error purging post", "post_id", postID, "error", err)
+			}
+		}
+	}
+
+	purged, err := app.store.Comments.PurgeDeletedBefore(ctx, before)
+	if err != nil {
+		app.logger.Error("error purging comments", "error", err)
+		return
+	}
+	if purged > 0 {
+		app.logger.Info("purged deleted comments", "count", purged)
+	}
+}
+
+// purgePost removes a deleted post's files from storage and then the post
+// itself. A failure leaves the post in the trash for the next run to retry.
+func (app *application) purgePost(ctx context.Context, postID int64) error {
+	files, err := app.store.PostFiles.GetByPostID(ctx, postID)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := app.storage.Delete(ctx, fmt.Sprintf("%s%s", file.FileID, file.FileExtension)); err != nil {
+			return err
+		}
+	}
+
+	return app.store.Posts.Purge(ctx, postID)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"newsdrop.org/store"
 )
 
@@ -12,8 +14,6 @@ type UpdateUserRolePayload struct {
 }
 
 func (app *application) updateUserRole(w http.ResponseWriter, r *http.Request) {
-	name := r.PathValue("userName")
-
 	var payload UpdateUserRolePayload
 
 	if err := readJSON(w, r, &payload); err != nil {
@@ -26,22 +26,59 @@ func (app *application) updateUserRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	target, ok := app.targetUser(w, r)
+	if !ok {
+		return
+	}
+
 	role, err := app.store.Roles.GetByName(r.Context(), payload.RoleName)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Nobody hands out more than they have themselves.
+	covers, err := app.store.Roles.Covers(r.Context(), getUserFromContext(r).Role.ID, role.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if !covers {
+		app.forbiddenResponse(w, r)
+		return
+	}
 
 	var user *store.User
 	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
-		user, err = app.store.Users.UpdateRole(r.Context(), name, role)
+		var err error
+		if user, err = s.Users.UpdateRole(r.Context(), target.ID, role); err != nil {
+			return err
+		}
+
+		managers, err := s.Users.CountWithPermission(r.Context(), store.PermRoleManage)
 		if err != nil {
 			return err
 		}
-		return nil
+		if managers == 0 {
+			return ErrLastRoleManager
+		}
+
+		return app.audit(s, r, "user_role_changed", "user", user.ID, target, user)
 	})
 	if err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, ErrLastRoleManager):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -65,7 +102,12 @@ func (app *application) profile(w http.ResponseWriter, r *http.Request) {
 
 		user, err = app.store.Users.GetByID(r.Context(), userID)
 		if err != nil {
-			app.internalServerError(w, r, err)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
 			return
 		}
 	}
@@ -75,3 +117,74 @@ func (app *application) profile(w http.ResponseWriter, r *http.Request) {
 		"user":    user,
 	})
 }
+
+func (app *application) followUser(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	userIDStr := r.PathValue("userID")
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if userID == user.ID {
+		app.badRequestResponse(w, r, ErrSelfFollow)
+		return
+	}
+
+	var follower *store.Follower
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		follower, err = s.Followers.Follow(r.Context(), user.ID, userID)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505":
+				app.conflictError(w, r, err)
+				return
+			case "23503":
+				app.notFoundError(w, r, err)
+				return
+			}
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, envelope{
+		"message":  "user followed",
+		"follower": follower,
+	})
+}
+
+func (app *application) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	userIDStr := r.PathValue("userID")
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.store.WithTx(r.Context(), func(s *store.Storage) error {
+		return s.Followers.Unfollow(r.Context(), user.ID, userID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -152,7 +152,7 @@ func createComments(q store.Storage) {
 	}
 
 	for _, comment := range comments {
-		_, err := q.Comments.Create(context.Background(), comment.Content, comment.UserID, comment.PostID)
+		_, err := q.Comments.Create(context.Background(), comment.Content, comment.UserID, comment.PostID, nil)
 		if err != nil {
 			log.Println(err)
 		}
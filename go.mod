@@ -2,11 +2,14 @@ module newsdrop.org
 
 go 1.25.3
 
-require github.com/go-playground/validator/v10 v10.28.0
+require (
+	github.com/aws/aws-sdk-go-v2/credentials v1.18.21
+	github.com/go-chi/httprate v0.15.0
+	github.com/go-playground/validator/v10 v10.28.0
+)
 
 require (
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.7.3 // indirect
-	github.com/aws/aws-sdk-go-v2/credentials v1.18.21 // indirect
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.18.13 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/configsources v1.4.13 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.7.13 // indirect
@@ -20,7 +23,6 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.35.5 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.39.1 // indirect
 	github.com/aws/smithy-go v1.23.2 // indirect
-	github.com/go-chi/httprate v0.15.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
 	github.com/mfridman/interpolate v0.0.2 // indirect
 	github.com/sethvargo/go-retry v0.3.0 // indirect
@@ -47,7 +49,7 @@ require (
 	github.com/pressly/goose/v3 v3.26.0
 	github.com/valkey-io/valkey-go v1.0.67
 	github.com/wneessen/go-mail v0.7.2
-	golang.org/x/crypto v0.43.0 // indirect
+	golang.org/x/crypto v0.43.0
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
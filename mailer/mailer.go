@@ -3,9 +3,16 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "NewsDrop"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName                = "NewsDrop"
+	maxRetries              = 3
+	UserWelcomeTemplate     = "user_welcome.tmpl"
+	PasswordResetTemplate   = "password_reset.tmpl"
+	AccountLockedTemplate   = "account_locked.tmpl"
+	MagicLinkTemplate       = "magic_link.tmpl"
+	EmailChangeTemplate     = "email_change_confirm.tmpl"
+	EmailNoticeTemplate     = "email_change_notice.tmpl"
+	ExportReadyTemplate     = "export_ready.tmpl"
+	AccountDeletionTemplate = "account_deletion.tmpl"
 )
 
 //go:embed "templates"
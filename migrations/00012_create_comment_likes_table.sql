@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS comment_likes (
+    user_id bigint not null references users(id) on delete cascade,
+    comment_id bigint not null references comments(id) on delete cascade,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    primary key (user_id, comment_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_likes_comment_id ON comment_likes (comment_id);
+
+ALTER TABLE comments DROP COLUMN IF EXISTS likes;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS likes bigint not null default 0;
+
+UPDATE comments c
+SET likes = (SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = c.id);
+
+DROP TABLE IF EXISTS comment_likes;
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+-- html_escape makes user text safe to pass through ts_headline, which copies
+-- its input into the snippet as-is around the <mark> tags it adds.
+CREATE OR REPLACE FUNCTION html_escape(input text)
+RETURNS text AS $$
+SELECT replace(replace(replace(replace(replace(input,
+    '&', '&amp;'),
+    '<', '&lt;'),
+    '>', '&gt;'),
+    '"', '&quot;'),
+    '''', '&#39;');
+$$ language sql IMMUTABLE STRICT;
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(display_name, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector);
+
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', coalesce(name, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_tags_search_vector ON tags USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tags_search_vector;
+ALTER TABLE tags DROP COLUMN IF EXISTS search_vector;
+
+DROP INDEX IF EXISTS idx_users_search_vector;
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
+
+DROP INDEX IF EXISTS idx_posts_search_vector;
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
+
+DROP FUNCTION IF EXISTS html_escape(text);
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint primary key references users(id) on delete cascade,
+    secret text not null,
+    last_used_step bigint not null default 0,
+    confirmed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id bigserial primary key,
+    user_id bigint not null references users(id) on delete cascade,
+    code_hash bytea not null,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    unique (user_id, code_hash)
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled bool not null default false;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS require_mfa bool not null default false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE roles DROP COLUMN IF EXISTS require_mfa;
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_enabled;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_identities (
+    id bigserial primary key,
+    user_id bigint not null references users(id) on delete cascade,
+    provider varchar(50) not null,
+    subject varchar(255) not null,
+    email citext not null default '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    constraint user_identities_provider_subject_key unique (provider, subject),
+    constraint user_identities_user_provider_key unique (user_id, provider)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
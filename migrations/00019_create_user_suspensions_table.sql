@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_suspensions (
+    id bigserial primary key,
+    user_id bigint not null references users(id) on delete cascade,
+    moderator_id bigint references users(id) on delete set null,
+    reason text not null,
+    -- A suspension without an expiry is a ban.
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    lifted_at TIMESTAMPTZ,
+    lifted_by bigint references users(id) on delete set null
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_suspensions_user_id ON user_suspensions (user_id)
+    WHERE lifted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_suspensions;
+-- +goose StatementEnd
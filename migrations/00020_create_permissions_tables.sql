@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL primary key,
+    name varchar(100) not null unique,
+    description text not null default '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id bigint not null references roles(id) on delete cascade,
+    permission_id bigint not null references permissions(id) on delete cascade,
+    primary key (role_id, permission_id)
+);
+
+-- Roles that ship with the API can't be deleted; users reference them.
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS system bool not null default false;
+UPDATE roles SET system = true WHERE name IN ('user', 'moderator', 'admin');
+
+INSERT INTO permissions (name, description) VALUES
+    ('post.update.any', 'edit posts written by other users'),
+    ('post.delete.any', 'delete posts written by other users'),
+    ('comment.moderate', 'edit and delete comments written by other users'),
+    ('tag.create', 'create tags'),
+    ('tag.delete', 'delete tags'),
+    ('user.manage', 'list, suspend, ban and unlock users'),
+    ('role.manage', 'create roles, change their permissions and assign them to users');
+
+-- Carry over what the moderator and admin levels allowed.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON p.name IN ('post.update.any', 'comment.moderate', 'tag.create', 'tag.delete')
+WHERE r.name = 'moderator';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'admin';
+
+-- Permissions replace levels entirely.
+ALTER TABLE roles DROP COLUMN IF EXISTS level;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS level int not null default 0;
+UPDATE roles SET level = CASE name
+    WHEN 'user' THEN 1
+    WHEN 'moderator' THEN 2
+    WHEN 'admin' THEN 3
+    ELSE 0
+END;
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+ALTER TABLE roles DROP COLUMN IF EXISTS system;
+-- +goose StatementEnd
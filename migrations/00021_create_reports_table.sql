@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ;
+
+-- Targets aren't foreign keys: a report outlives the post or comment a
+-- moderator deleted because of it.
+CREATE TABLE IF NOT EXISTS reports (
+    id bigserial primary key,
+    reporter_id bigint references users(id) on delete set null,
+    target_type varchar(20) not null,
+    target_id bigint not null,
+    post_id bigint not null,
+    reason varchar(30) not null,
+    details text not null default '',
+    status varchar(20) not null default 'open',
+    assignee_id bigint references users(id) on delete set null,
+    resolution varchar(20),
+    resolver_id bigint references users(id) on delete set null,
+    note text not null default '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_status ON reports (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_reports_target ON reports (target_type, target_id);
+
+-- One pending report per reader per target.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_reporter_target ON reports (reporter_id, target_type, target_id)
+    WHERE status IN ('open', 'assigned');
+
+CREATE TRIGGER update_reports_updated_at
+BEFORE UPDATE ON reports
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO permissions (name, description)
+VALUES ('report.moderate', 'work the report queue and hide or delete reported content');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON p.name = 'report.moderate'
+WHERE r.name IN ('moderator', 'admin');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'report.moderate';
+DROP TRIGGER IF EXISTS update_reports_updated_at ON reports;
+DROP TABLE IF EXISTS reports;
+ALTER TABLE comments DROP COLUMN IF EXISTS hidden_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS hidden_at;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Authors may only restore what they deleted themselves, not what a
+-- moderator took down.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_by bigint references users(id) on delete set null;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_by bigint references users(id) on delete set null;
+
+-- The retention job looks for trash older than the retention period.
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at)
+    WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at)
+    WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_comments_deleted_at;
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id bigserial primary key,
+    post_id bigint not null references posts(id) on delete cascade,
+    -- Revision 1 is the post as first published.
+    revision int not null,
+    title varchar(30) not null,
+    content varchar(2048) not null,
+    editor_id bigint references users(id) on delete set null,
+    -- A redacted revision keeps its place in the history but not its text.
+    redacted_at TIMESTAMPTZ,
+    redacted_by bigint references users(id) on delete set null,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    unique (post_id, revision)
+);
+
+-- Earlier edits weren't kept, so existing posts start from what they say now.
+INSERT INTO post_revisions (post_id, revision, title, content, editor_id, created_at)
+SELECT id, 1, title, content, user_id, created_at
+FROM posts;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS post_revisions;
+ALTER TABLE posts DROP COLUMN IF EXISTS edited_at;
+-- +goose StatementEnd
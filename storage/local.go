@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type LocalStorage struct {
+	dir    string
+	signer urlSigner
+}
+
+func NewLocalStorage(dir, baseURL string, secret []byte) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{
+		dir:    dir,
+		signer: urlSigner{baseURL: baseURL, secret: secret},
+	}, nil
+}
+
+func (s *LocalStorage) Save(ctx context.Context, file io.Reader, fileExt, filename string) error {
+	if err := validKey(filename); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, filename))
+}
+
+func (s *LocalStorage) GetURL(ctx context.Context, filename string) (string, error) {
+	if err := validKey(filename); err != nil {
+		return "", err
+	}
+	return s.signer.url(filename), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, filename string) error {
+	if err := validKey(filename); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(s.dir, filename))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Open(ctx context.Context, filename string) (io.ReadCloser, error) {
+	if err := validKey(filename); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, filename))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *LocalStorage) Verify(filename, expires, signature string) error {
+	return s.signer.verify(filename, expires, signature)
+}
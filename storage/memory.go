@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// MemoryStorage keeps objects in process memory. It is meant for tests and
+// throwaway environments; everything is lost when the process exits.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+	signer  urlSigner
+}
+
+func NewMemoryStorage(baseURL string, secret []byte) *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string][]byte),
+		signer:  urlSigner{baseURL: baseURL, secret: secret},
+	}
+}
+
+func (s *MemoryStorage) Save(ctx context.Context, file io.Reader, fileExt, filename string) error {
+	if err := validKey(filename); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[filename] = data
+
+	return nil
+}
+
+func (s *MemoryStorage) GetURL(ctx context.Context, filename string) (string, error) {
+	if err := validKey(filename); err != nil {
+		return "", err
+	}
+	return s.signer.url(filename), nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, filename)
+
+	return nil
+}
+
+func (s *MemoryStorage) Open(ctx context.Context, filename string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.objects[filename]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStorage) Verify(filename, expires, signature string) error {
+	return s.signer.verify(filename, expires, signature)
+}
@@ -2,14 +2,15 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"mime/multipart"
-	"time"
+	"io"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type R2Client struct {
@@ -52,7 +53,7 @@ func NewPresignClient(client *s3.Client) *s3.PresignClient {
 	return s3.NewPresignClient(client)
 }
 
-func (c *R2Client) SaveToR2(ctx context.Context, file multipart.File, fileExt, filename string) error {
+func (c *R2Client) Save(ctx context.Context, file io.Reader, fileExt, filename string) error {
 	_, err := c.Client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(c.BucketName),
 		Key:         aws.String(filename),
@@ -66,11 +67,11 @@ func (c *R2Client) SaveToR2(ctx context.Context, file multipart.File, fileExt, f
 	return nil
 }
 
-func (c *R2Client) GetFromR2(ctx context.Context, filename string) (string, error) {
+func (c *R2Client) GetURL(ctx context.Context, filename string) (string, error) {
 	presignResult, err := c.PresignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(c.BucketName),
 		Key:    aws.String(filename),
-	}, s3.WithPresignExpires(15*time.Minute))
+	}, s3.WithPresignExpires(signedURLExpiry))
 	if err != nil {
 		return "", err
 	}
@@ -78,7 +79,7 @@ func (c *R2Client) GetFromR2(ctx context.Context, filename string) (string, erro
 	return presignResult.URL, nil
 }
 
-func (c *R2Client) DeleteFromR2(ctx context.Context, filename string) error {
+func (c *R2Client) Delete(ctx context.Context, filename string) error {
 	_, err := c.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(c.BucketName),
 		Key:    aws.String(filename),
@@ -88,3 +89,18 @@ func (c *R2Client) DeleteFromR2(ctx context.Context, filename string) error {
 	}
 	return nil
 }
+
+func (c *R2Client) Open(ctx context.Context, filename string) (io.ReadCloser, error) {
+	out, err := c.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.BucketName),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
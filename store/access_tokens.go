@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can't be mistaken
+// for JWTs and are easy to spot in leaked-secret scans.
+const AccessTokenPrefix = "ndp_"
+
+const (
+	AccessScopePostsRead     = "posts:read"
+	AccessScopePostsWrite    = "posts:write"
+	AccessScopeCommentsRead  = "comments:read"
+	AccessScopeCommentsWrite = "comments:write"
+	AccessScopeTagsWrite     = "tags:write"
+	AccessScopeUsersRead     = "users:read"
+	AccessScopeUsersWrite    = "users:write"
+)
+
+var AccessTokenScopes = []string{
+	AccessScopePostsRead,
+	AccessScopePostsWrite,
+	AccessScopeCommentsRead,
+	AccessScopeCommentsWrite,
+	AccessScopeTagsWrite,
+	AccessScopeUsersRead,
+	AccessScopeUsersWrite,
+}
+
+// AccessToken is a personal access token for bots and integrations. Only the
+// hash is stored; Plaintext is set once, when the token is created.
+type AccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Plaintext  string     `json:"token,omitempty"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *AccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+func hashAccessToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+type AccessTokenStore struct {
+	db DBTX
+}
+
+// Create stores a new token. A nil expiresAt means the token never expires.
+func (s *AccessTokenStore) Create(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time) (*AccessToken, error) {
+	randomBytes := make([]byte, 20)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	token := &AccessToken{
+		UserID:    userID,
+		Name:      name,
+		Plaintext: AccessTokenPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	token.Hash = hashAccessToken(token.Plaintext)
+
+	query := `
+	INSERT INTO personal_access_tokens (user_id, name, hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	err := s.db.QueryRow(ctx, query,
+		token.UserID,
+		token.Name,
+		token.Hash,
+		token.Scopes,
+		token.ExpiresAt,
+	).Scan(
+		&token.ID,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetByPlaintext returns an unexpired token and records that it was used.
+func (s *AccessTokenStore) GetByPlaintext(ctx context.Context, plaintext string) (*AccessToken, error) {
+	var token AccessToken
+	query := `
+	UPDATE personal_access_tokens
+	SET last_used_at = NOW()
+	WHERE hash = $1
+	AND (expires_at IS NULL OR expires_at > NOW())
+	RETURNING id, user_id, name, scopes, expires_at, last_used_at, created_at`
+
+	err := s.db.QueryRow(ctx, query, hashAccessToken(plaintext)).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &token, nil
+}
+
+func (s *AccessTokenStore) List(ctx context.Context, userID int64) ([]*AccessToken, error) {
+	query := `
+	SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+	FROM personal_access_tokens
+	WHERE user_id = $1
+	ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*AccessToken{}
+	for rows.Next() {
+		var token AccessToken
+		if err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Name,
+			&token.Scopes,
+			&token.ExpiresAt,
+			&token.LastUsedAt,
+			&token.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (s *AccessTokenStore) Delete(ctx context.Context, id, userID int64) error {
+	query := `
+	DELETE FROM personal_access_tokens
+	WHERE id = $1 AND user_id = $2`
+
+	result, err := s.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteByUser revokes every token the user has, for when the account may
+// be in the wrong hands.
+func (s *AccessTokenStore) DeleteByUser(ctx context.Context, userID int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE user_id = $1`
+
+	_, err := s.db.Exec(ctx, query, userID)
+	return err
+}
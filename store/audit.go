@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent records a privileged action: who did what to which target, and
+// the target's state on either side of the change. Events are never updated
+// or deleted.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	ActorName  string          `json:"actor_name"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	RequestID  string          `json:"request_id"`
+	IP         string          `json:"ip"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows List. Zero values match everything.
+type AuditFilter struct {
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+}
+
+type AuditLogStore struct {
+	db DBTX
+}
+
+func (s *AuditLogStore) Create(ctx context.Context, event *AuditEvent) error {
+	query := `
+	INSERT INTO audit_events (actor_id, actor_name, action, target_type, target_id, request_id, ip, before_state, after_state)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, created_at`
+
+	return s.db.QueryRow(ctx, query,
+		event.ActorID,
+		event.ActorName,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.RequestID,
+		event.IP,
+		event.Before,
+		event.After,
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+// List returns a page of events, newest first.
+func (s *AuditLogStore) List(ctx context.Context, filter AuditFilter, limit, offset int64) (int64, []*AuditEvent, error) {
+	const where = `
+	WHERE ($1::bigint IS NULL OR actor_id = $1)
+	AND ($2::text = '' OR action = $2)
+	AND ($3::text = '' OR target_type = $3)
+	AND ($4::text = '' OR target_id = $4)
+	AND ($5::timestamptz IS NULL OR created_at >= $5)
+	AND ($6::timestamptz IS NULL OR created_at < $6)`
+
+	var total int64
+	query := `SELECT COUNT(*) FROM audit_events` + where
+	if err := s.db.QueryRow(ctx, query,
+		filter.ActorID,
+		filter.Action,
+		filter.TargetType,
+		filter.TargetID,
+		filter.Since,
+		filter.Until,
+	).Scan(&total); err != nil {
+		return -1, nil, err
+	}
+
+	query = `
+	SELECT id, actor_id, actor_name, action, target_type, target_id, request_id, ip,
+	       before_state, after_state, created_at
+	FROM audit_events` + where + `
+	ORDER BY created_at DESC, id DESC
+	LIMIT $7 OFFSET $8`
+
+	rows, err := s.db.Query(ctx, query,
+		filter.ActorID,
+		filter.Action,
+		filter.TargetType,
+		filter.TargetID,
+		filter.Since,
+		filter.Until,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.ActorID,
+			&event.ActorName,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&event.RequestID,
+			&event.IP,
+			&event.Before,
+			&event.After,
+			&event.CreatedAt,
+		); err != nil {
+			return -1, nil, err
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	return total, events, nil
+}
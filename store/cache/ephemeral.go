@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// EphemeralStore holds short-lived values that belong to a flow rather than
+// a session: login challenges, OIDC state and cooldowns.
+type EphemeralStore struct {
+	vdb valkey.Client
+}
+
+func ephemeralKey(key string) string {
+	return "ephemeral:" + key
+}
+
+// SetNX stores value under key for ttl unless the key is already set, and
+// reports whether it did.
+func (s *EphemeralStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	seconds := max(int64(ttl.Seconds()), 1)
+
+	err := s.vdb.Do(ctx, s.vdb.B().Set().Key(ephemeralKey(key)).Value(value).Nx().ExSeconds(seconds).Build()).Error()
+	if valkey.IsValkeyNil(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get returns ErrCacheMiss when key isn't set.
+func (s *EphemeralStore) Get(ctx context.Context, key string) (string, error) {
+	value, err := s.vdb.Do(ctx, s.vdb.B().Get().Key(ephemeralKey(key)).Build()).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", ErrCacheMiss
+	}
+	return value, err
+}
+
+// GetDel removes key and returns what it held, so only one caller gets the
+// value. It returns ErrCacheMiss when key isn't set.
+func (s *EphemeralStore) GetDel(ctx context.Context, key string) (string, error) {
+	value, err := s.vdb.Do(ctx, s.vdb.B().Getdel().Key(ephemeralKey(key)).Build()).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", ErrCacheMiss
+	}
+	return value, err
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// LoginAttemptStore counts failed logins per subject (an email or an IP) and
+// holds temporary lockouts. Counts live for window from the first failure.
+type LoginAttemptStore struct {
+	vdb valkey.Client
+}
+
+func loginFailuresKey(subject string) string {
+	return "login_failures:" + subject
+}
+
+func loginLockKey(subject string) string {
+	return "login_lock:" + subject
+}
+
+func loginSourcesKey(subject string) string {
+	return "login_sources:" + subject
+}
+
+func (s *LoginAttemptStore) Fail(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	key := loginFailuresKey(subject)
+
+	resps := s.vdb.DoMulti(ctx,
+		s.vdb.B().Incr().Key(key).Build(),
+		s.vdb.B().Expire().Key(key).Seconds(int64(window.Seconds())).Nx().Build(),
+	)
+	for _, resp := range resps[1:] {
+		if err := resp.Error(); err != nil {
+			return 0, err
+		}
+	}
+
+	return resps[0].AsInt64()
+}
+
+func (s *LoginAttemptStore) Lock(ctx context.Context, subject string, until time.Time) error {
+	ttl := time.Until(until).Seconds()
+	if ttl <= 0 {
+		return nil
+	}
+
+	value := strconv.FormatInt(until.Unix(), 10)
+	return s.vdb.Do(ctx, s.vdb.B().Setex().Key(loginLockKey(subject)).Seconds(int64(ttl)).Value(value).Build()).Error()
+}
+
+// LockedUntil returns ErrCacheMiss when subject isn't locked.
+func (s *LoginAttemptStore) LockedUntil(ctx context.Context, subject string) (time.Time, error) {
+	unix, err := s.vdb.Do(ctx, s.vdb.B().Get().Key(loginLockKey(subject)).Build()).AsInt64()
+	if valkey.IsValkeyNil(err) {
+		return time.Time{}, ErrCacheMiss
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(unix, 0), nil
+}
+
+// AddSource remembers where a failure against subject came from, so that
+// unlocking an account can clear the IPs that were locked along with it.
+func (s *LoginAttemptStore) AddSource(ctx context.Context, subject, source string, window time.Duration) error {
+	key := loginSourcesKey(subject)
+
+	for _, resp := range s.vdb.DoMulti(ctx,
+		s.vdb.B().Sadd().Key(key).Member(source).Build(),
+		s.vdb.B().Expire().Key(key).Seconds(int64(window.Seconds())).Nx().Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LoginAttemptStore) Sources(ctx context.Context, subject string) ([]string, error) {
+	return s.vdb.Do(ctx, s.vdb.B().Smembers().Key(loginSourcesKey(subject)).Build()).AsStrSlice()
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, subject string) error {
+	return s.vdb.Do(ctx, s.vdb.B().Del().Key(loginFailuresKey(subject), loginLockKey(subject), loginSourcesKey(subject)).Build()).Error()
+}
@@ -0,0 +1,402 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"newsdrop.org/store"
+)
+
+type memoryItem struct {
+	value string
+	exp   time.Time
+}
+
+type memorySet struct {
+	members map[string]struct{}
+	exp     time.Time
+}
+
+// MemoryCache is an in-process key/value store with per-key expiry. It backs
+// the cache interfaces when Valkey is disabled, so it only works for a single
+// API instance.
+type MemoryCache struct {
+	mu    sync.RWMutex
+	items map[string]memoryItem
+	sets  map[string]*memorySet
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewMemoryCache starts a cache whose expired keys are swept every interval.
+// Call Close to stop the sweeper.
+func NewMemoryCache(interval time.Duration) *MemoryCache {
+	c := &MemoryCache{
+		items: make(map[string]memoryItem),
+		sets:  make(map[string]*memorySet),
+		done:  make(chan struct{}),
+	}
+
+	go c.sweep(interval)
+
+	return c
+}
+
+func (c *MemoryCache) Close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *MemoryCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for key, item := range c.items {
+				if now.After(item.exp) {
+					delete(c.items, key)
+				}
+			}
+			for key, set := range c.sets {
+				if now.After(set.exp) {
+					delete(c.sets, key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *MemoryCache) get(key string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.exp) {
+		return "", ErrCacheMiss
+	}
+	return item.value, nil
+}
+
+func (c *MemoryCache) set(key, value string, exp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[key] = memoryItem{value: value, exp: exp}
+}
+
+// setNX sets key only if it is missing or expired, and reports whether it
+// did.
+func (c *MemoryCache) setNX(key, value string, exp time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[key]; ok && !time.Now().After(item.exp) {
+		return false
+	}
+	c.items[key] = memoryItem{value: value, exp: exp}
+	return true
+}
+
+// getDel removes key and returns what it held.
+func (c *MemoryCache) getDel(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.exp) {
+		return "", ErrCacheMiss
+	}
+	delete(c.items, key)
+	return item.value, nil
+}
+
+func (c *MemoryCache) del(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.items, key)
+		delete(c.sets, key)
+	}
+}
+
+// incr bumps a counter, starting a fresh one that expires at exp if the key
+// is missing or expired.
+func (c *MemoryCache) incr(key string, exp time.Time) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.exp) {
+		item = memoryItem{value: "0", exp: exp}
+	}
+
+	n, _ := strconv.ParseInt(item.value, 10, 64)
+	n++
+	item.value = strconv.FormatInt(n, 10)
+	c.items[key] = item
+
+	return n
+}
+
+// addMember adds member to the set at key. Like SADD followed by EXPIRE NX,
+// exp only applies when the set is fresh; adding to a live set leaves its
+// expiry alone.
+func (c *MemoryCache) addMember(key, member string, exp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addMemberLocked(key, member, exp)
+}
+
+// extendMember is addMember that also pushes a live set's expiry out to exp
+// if that is later, matching EXPIRE NX followed by EXPIRE GT.
+func (c *MemoryCache) extendMember(key, member string, exp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set := c.addMemberLocked(key, member, exp)
+	if exp.After(set.exp) {
+		set.exp = exp
+	}
+}
+
+func (c *MemoryCache) addMemberLocked(key, member string, exp time.Time) *memorySet {
+	set, ok := c.sets[key]
+	if !ok || time.Now().After(set.exp) {
+		set = &memorySet{members: make(map[string]struct{}), exp: exp}
+		c.sets[key] = set
+	}
+	set.members[member] = struct{}{}
+	return set
+}
+
+// removeMember drops member from the set at key, and the set itself once it
+// is empty, as SREM does.
+func (c *MemoryCache) removeMember(key, member string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if set, ok := c.sets[key]; ok {
+		delete(set.members, member)
+		if len(set.members) == 0 {
+			delete(c.sets, key)
+		}
+	}
+}
+
+func (c *MemoryCache) members(key string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	set, ok := c.sets[key]
+	if !ok || time.Now().After(set.exp) {
+		return nil
+	}
+
+	members := make([]string, 0, len(set.members))
+	for member := range set.members {
+		members = append(members, member)
+	}
+	return members
+}
+
+func NewMemoryStorage(c *MemoryCache) Storage {
+	return Storage{
+		Users:         &MemoryUserStore{c: c},
+		Sessions:      &MemorySessionStore{c: c},
+		LoginAttempts: &MemoryLoginAttemptStore{c: c},
+		Ephemeral:     &MemoryEphemeralStore{c: c},
+	}
+}
+
+type MemoryUserStore struct {
+	c *MemoryCache
+}
+
+func (s *MemoryUserStore) Get(ctx context.Context, userID int64) (*store.User, error) {
+	data, err := s.c.get(fmt.Sprintf("user-%v", userID))
+	if errors.Is(err, ErrCacheMiss) {
+		return nil, nil
+	}
+
+	var user store.User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *MemoryUserStore) Set(ctx context.Context, user *store.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	s.c.set(fmt.Sprintf("user-%v", user.ID), string(data), time.Now().Add(UserExpTime))
+	return nil
+}
+
+type MemorySessionStore struct {
+	c *MemoryCache
+}
+
+func (s *MemorySessionStore) GetUser(ctx context.Context, key string) (string, error) {
+	return s.c.get(key)
+}
+
+func (s *MemorySessionStore) Set(ctx context.Context, key, userID string, exp time.Time) error {
+	s.c.set(key, userID, exp)
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, key string) error {
+	s.c.del(key)
+	return nil
+}
+
+func (s *MemorySessionStore) SaveSession(ctx context.Context, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	s.c.set(sessionKey(session.ID), string(data), session.ExpiresAt)
+	s.c.extendMember(userSessionsKey(session.UserID), session.ID, session.ExpiresAt)
+	return nil
+}
+
+func (s *MemorySessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	data, err := s.c.get(sessionKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *MemorySessionStore) ListSessions(ctx context.Context, userID string) ([]*Session, error) {
+	ids := s.c.members(userSessionsKey(userID))
+	sessions := make([]*Session, 0, len(ids))
+
+	for _, id := range ids {
+		session, err := s.GetSession(ctx, id)
+		if errors.Is(err, ErrCacheMiss) {
+			s.c.removeMember(userSessionsKey(userID), id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) DeleteSession(ctx context.Context, session *Session) error {
+	s.c.del(sessionKey(session.ID), "access:"+session.AccessJTI, "refresh:"+session.RefreshJTI)
+	s.c.removeMember(userSessionsKey(session.UserID), session.ID)
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteByUser(ctx context.Context, userID string) error {
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := s.DeleteSession(ctx, session); err != nil {
+			return err
+		}
+	}
+
+	s.c.del(userSessionsKey(userID))
+	return nil
+}
+
+func (s *MemorySessionStore) RetireRefreshToken(ctx context.Context, jti, sessionID string, exp time.Time) (bool, error) {
+	return s.c.setNX(retiredRefreshKey(jti), sessionID, exp), nil
+}
+
+func (s *MemorySessionStore) ReleaseRefreshToken(ctx context.Context, jti string) error {
+	s.c.del(retiredRefreshKey(jti))
+	return nil
+}
+
+func (s *MemorySessionStore) GetRetiredRefreshToken(ctx context.Context, jti string) (string, error) {
+	return s.c.get(retiredRefreshKey(jti))
+}
+
+type MemoryLoginAttemptStore struct {
+	c *MemoryCache
+}
+
+func (s *MemoryLoginAttemptStore) Fail(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	return s.c.incr(loginFailuresKey(subject), time.Now().Add(window)), nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(ctx context.Context, subject string, until time.Time) error {
+	s.c.set(loginLockKey(subject), strconv.FormatInt(until.Unix(), 10), until)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) LockedUntil(ctx context.Context, subject string) (time.Time, error) {
+	data, err := s.c.get(loginLockKey(subject))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	unix, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(unix, 0), nil
+}
+
+func (s *MemoryLoginAttemptStore) AddSource(ctx context.Context, subject, source string, window time.Duration) error {
+	s.c.addMember(loginSourcesKey(subject), source, time.Now().Add(window))
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Sources(ctx context.Context, subject string) ([]string, error) {
+	return s.c.members(loginSourcesKey(subject)), nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, subject string) error {
+	s.c.del(loginFailuresKey(subject), loginLockKey(subject), loginSourcesKey(subject))
+	return nil
+}
+
+type MemoryEphemeralStore struct {
+	c *MemoryCache
+}
+
+func (s *MemoryEphemeralStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.c.setNX(ephemeralKey(key), value, time.Now().Add(ttl)), nil
+}
+
+func (s *MemoryEphemeralStore) Get(ctx context.Context, key string) (string, error) {
+	return s.c.get(ephemeralKey(key))
+}
+
+func (s *MemoryEphemeralStore) GetDel(ctx context.Context, key string) (string, error) {
+	return s.c.getDel(ephemeralKey(key))
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMemoryCache(t *testing.T, interval time.Duration) *MemoryCache {
+	t.Helper()
+
+	c := NewMemoryCache(interval)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	c := newTestMemoryCache(t, time.Hour)
+	exp := time.Now().Add(20 * time.Millisecond)
+
+	c.set("item", "value", exp)
+	c.incr("counter", exp)
+	c.addMember("set", "a", exp)
+
+	if v, err := c.get("item"); err != nil || v != "value" {
+		t.Fatalf("get before expiry = %q, %v", v, err)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	if _, err := c.get("item"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("get after expiry: err = %v, want ErrCacheMiss", err)
+	}
+	if _, err := c.getDel("item"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("getDel after expiry: err = %v, want ErrCacheMiss", err)
+	}
+	if members := c.members("set"); len(members) != 0 {
+		t.Errorf("members after expiry = %v", members)
+	}
+	if n := c.incr("counter", time.Now().Add(time.Hour)); n != 1 {
+		t.Errorf("incr after expiry = %d, want a fresh count of 1", n)
+	}
+	if !c.setNX("item", "new", time.Now().Add(time.Hour)) {
+		t.Error("setNX refused an expired key")
+	}
+}
+
+func TestMemoryCacheSetExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(c *MemoryCache, key, member string, exp time.Time)
+		// wantLive is whether the set outlives its first expiry after a
+		// second add with a later one.
+		wantLive bool
+	}{
+		{name: "addMember keeps the first expiry", add: (*MemoryCache).addMember, wantLive: false},
+		{name: "extendMember takes the later expiry", add: (*MemoryCache).extendMember, wantLive: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestMemoryCache(t, time.Hour)
+
+			tt.add(c, "set", "a", time.Now().Add(20*time.Millisecond))
+			tt.add(c, "set", "b", time.Now().Add(time.Hour))
+
+			time.Sleep(40 * time.Millisecond)
+
+			live := len(c.members("set")) == 2
+			if live != tt.wantLive {
+				t.Errorf("set live = %v, want %v", live, tt.wantLive)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheRemoveLastMember(t *testing.T) {
+	c := newTestMemoryCache(t, time.Hour)
+
+	c.addMember("set", "a", time.Now().Add(20*time.Millisecond))
+	c.removeMember("set", "a")
+
+	// With the set gone, the next add starts a fresh one with its own
+	// expiry rather than inheriting the old one.
+	c.addMember("set", "b", time.Now().Add(time.Hour))
+	time.Sleep(40 * time.Millisecond)
+
+	if members := c.members("set"); len(members) != 1 || members[0] != "b" {
+		t.Errorf("members = %v, want [b]", members)
+	}
+}
+
+func TestMemoryCacheSweep(t *testing.T) {
+	c := newTestMemoryCache(t, 5*time.Millisecond)
+	exp := time.Now().Add(time.Millisecond)
+
+	c.set("item", "value", exp)
+	c.addMember("set", "a", exp)
+	c.set("live", "value", time.Now().Add(time.Hour))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.RLock()
+		items, sets := len(c.items), len(c.sets)
+		c.mu.RUnlock()
+
+		if items == 1 && sets == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sweeper left %d items and %d sets, want 1 and 0", items, sets)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := c.get("live"); err != nil {
+		t.Errorf("sweeper removed a live key: %v", err)
+	}
+
+	// Close stops the sweeper and is safe to call more than once.
+	c.Close()
+	c.Close()
+}
+
+func TestMemoryCacheConcurrentAccess(t *testing.T) {
+	c := newTestMemoryCache(t, time.Millisecond)
+	exp := time.Now().Add(time.Hour)
+
+	const workers, rounds = 8, 200
+
+	var wg sync.WaitGroup
+	claimed := make(chan struct{}, workers*rounds)
+
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			member := strconv.Itoa(w)
+			for i := range rounds {
+				key := "item-" + strconv.Itoa(i)
+
+				c.incr("counter", exp)
+				c.set(key, member, exp)
+				c.get(key)
+				c.addMember("set", member, exp)
+				c.members("set")
+				if c.setNX("once-"+strconv.Itoa(i), member, exp) {
+					claimed <- struct{}{}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(claimed)
+
+	if v, err := c.get("counter"); err != nil || v != strconv.Itoa(workers*rounds) {
+		t.Errorf("counter = %q, %v, want %d", v, err, workers*rounds)
+	}
+	if members := c.members("set"); len(members) != workers {
+		t.Errorf("set has %d members, want %d", len(members), workers)
+	}
+	if n := len(claimed); n != rounds {
+		t.Errorf("setNX succeeded %d times for %d keys", n, rounds)
+	}
+}
@@ -2,15 +2,47 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/valkey-io/valkey-go"
 )
 
+// Session describes one signed-in device. Its access and refresh JTIs point
+// at the access:<jti> and refresh:<jti> keys checked on every request. A
+// session is also the family of every refresh token rotated from its login;
+// Generation counts those rotations.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	AccessJTI  string    `json:"access_jti"`
+	RefreshJTI string    `json:"refresh_jti"`
+	Generation int       `json:"generation"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
 type SessionStore struct {
 	vdb valkey.Client
 }
 
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID string) string {
+	return "sessions:" + userID
+}
+
+func retiredRefreshKey(jti string) string {
+	return "refresh_retired:" + jti
+}
+
 func (s *SessionStore) GetUser(ctx context.Context, key string) (string, error) {
 	return s.vdb.Do(ctx, s.vdb.B().Get().Key(key).Build()).ToString()
 }
@@ -23,3 +55,134 @@ func (s *SessionStore) Set(ctx context.Context, key, userID string, exp time.Tim
 func (s *SessionStore) Delete(ctx context.Context, key string) error {
 	return s.vdb.Do(ctx, s.vdb.B().Del().Key(key).Build()).Error()
 }
+
+func (s *SessionStore) SaveSession(ctx context.Context, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	ttl := int64(time.Until(session.ExpiresAt).Seconds())
+	indexKey := userSessionsKey(session.UserID)
+
+	// The index lives as long as the longest-lived session in it: NX sets a
+	// TTL on a fresh set, GT only ever extends it.
+	for _, resp := range s.vdb.DoMulti(ctx,
+		s.vdb.B().Setex().Key(sessionKey(session.ID)).Seconds(ttl).Value(string(data)).Build(),
+		s.vdb.B().Sadd().Key(indexKey).Member(session.ID).Build(),
+		s.vdb.B().Expire().Key(indexKey).Seconds(ttl).Nx().Build(),
+		s.vdb.B().Expire().Key(indexKey).Seconds(ttl).Gt().Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	data, err := s.vdb.Do(ctx, s.vdb.B().Get().Key(sessionKey(id)).Build()).ToString()
+	if valkey.IsValkeyNil(err) {
+		return nil, ErrCacheMiss
+	} else if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *SessionStore) ListSessions(ctx context.Context, userID string) ([]*Session, error) {
+	ids, err := s.vdb.Do(ctx, s.vdb.B().Smembers().Key(userSessionsKey(userID)).Build()).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(ids))
+	var expired []string
+
+	for _, id := range ids {
+		session, err := s.GetSession(ctx, id)
+		if errors.Is(err, ErrCacheMiss) {
+			expired = append(expired, id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if len(expired) > 0 {
+		err := s.vdb.Do(ctx, s.vdb.B().Srem().Key(userSessionsKey(userID)).Member(expired...).Build()).Error()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *SessionStore) DeleteSession(ctx context.Context, session *Session) error {
+	for _, resp := range s.vdb.DoMulti(ctx,
+		s.vdb.B().Del().Key(
+			sessionKey(session.ID),
+			"access:"+session.AccessJTI,
+			"refresh:"+session.RefreshJTI,
+		).Build(),
+		s.vdb.B().Srem().Key(userSessionsKey(session.UserID)).Member(session.ID).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionStore) DeleteByUser(ctx context.Context, userID string) error {
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := s.DeleteSession(ctx, session); err != nil {
+			return err
+		}
+	}
+
+	return s.vdb.Do(ctx, s.vdb.B().Del().Key(userSessionsKey(userID)).Build()).Error()
+}
+
+// RetireRefreshToken remembers which session a rotated refresh token belonged
+// to until it would have expired, so a replay can be traced to its family.
+// Only one caller can retire a token: the rest get false, which makes it the
+// claim that lets a refresh go ahead.
+func (s *SessionStore) RetireRefreshToken(ctx context.Context, jti, sessionID string, exp time.Time) (bool, error) {
+	ttl := max(int64(time.Until(exp).Seconds()), 1)
+
+	err := s.vdb.Do(ctx, s.vdb.B().Set().Key(retiredRefreshKey(jti)).Value(sessionID).Nx().ExSeconds(ttl).Build()).Error()
+	if valkey.IsValkeyNil(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseRefreshToken takes back a RetireRefreshToken whose rotation didn't
+// go through, so the client can try again with the same token.
+func (s *SessionStore) ReleaseRefreshToken(ctx context.Context, jti string) error {
+	return s.vdb.Do(ctx, s.vdb.B().Del().Key(retiredRefreshKey(jti)).Build()).Error()
+}
+
+func (s *SessionStore) GetRetiredRefreshToken(ctx context.Context, jti string) (string, error) {
+	sessionID, err := s.vdb.Do(ctx, s.vdb.B().Get().Key(retiredRefreshKey(jti)).Build()).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", ErrCacheMiss
+	}
+	return sessionID, err
+}
@@ -2,12 +2,15 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"newsdrop.org/store"
 	"github.com/valkey-io/valkey-go"
 )
 
+var ErrCacheMiss = errors.New("cache: key not found")
+
 type Storage struct {
 	Users interface {
 		Get(context.Context, int64) (*store.User, error)
@@ -17,12 +20,35 @@ type Storage struct {
 		GetUser(ctx context.Context, key string) (string, error)
 		Set(ctx context.Context, key, userID string, exp time.Time) error
 		Delete(ctx context.Context, key string) error
+		SaveSession(ctx context.Context, session *Session) error
+		GetSession(ctx context.Context, id string) (*Session, error)
+		ListSessions(ctx context.Context, userID string) ([]*Session, error)
+		DeleteSession(ctx context.Context, session *Session) error
+		DeleteByUser(ctx context.Context, userID string) error
+		RetireRefreshToken(ctx context.Context, jti, sessionID string, exp time.Time) (bool, error)
+		ReleaseRefreshToken(ctx context.Context, jti string) error
+		GetRetiredRefreshToken(ctx context.Context, jti string) (string, error)
+	}
+	LoginAttempts interface {
+		Fail(ctx context.Context, subject string, window time.Duration) (int64, error)
+		Lock(ctx context.Context, subject string, until time.Time) error
+		LockedUntil(ctx context.Context, subject string) (time.Time, error)
+		AddSource(ctx context.Context, subject, source string, window time.Duration) error
+		Sources(ctx context.Context, subject string) ([]string, error)
+		Reset(ctx context.Context, subject string) error
+	}
+	Ephemeral interface {
+		SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+		Get(ctx context.Context, key string) (string, error)
+		GetDel(ctx context.Context, key string) (string, error)
 	}
 }
 
 func NewValkeyStorage(vdb valkey.Client) Storage {
 	return Storage{
-		Users:    &UserStore{vdb: vdb},
-		Sessions: &SessionStore{vdb: vdb},
+		Users:         &UserStore{vdb: vdb},
+		Sessions:      &SessionStore{vdb: vdb},
+		LoginAttempts: &LoginAttemptStore{vdb: vdb},
+		Ephemeral:     &EphemeralStore{vdb: vdb},
 	}
 }
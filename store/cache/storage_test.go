@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// backends runs test against the in-memory cache and, when VALKEY_TEST_ADDR
+// points at a server, against Valkey too, so the two stay interchangeable.
+// Valkey expiries are in whole seconds, so tests that wait on one sleep a
+// little over a second.
+func backends(t *testing.T, test func(t *testing.T, s Storage)) {
+	t.Run("memory", func(t *testing.T) {
+		c := NewMemoryCache(time.Minute)
+		t.Cleanup(c.Close)
+		test(t, NewMemoryStorage(c))
+	})
+
+	t.Run("valkey", func(t *testing.T) {
+		addr := os.Getenv("VALKEY_TEST_ADDR")
+		if addr == "" {
+			t.Skip("VALKEY_TEST_ADDR not set")
+		}
+
+		vdb, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{addr}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(vdb.Close)
+		test(t, NewValkeyStorage(vdb))
+	})
+}
+
+// uniqueKey keeps runs against a shared Valkey from seeing each other's keys.
+func uniqueKey(t *testing.T) string {
+	return t.Name() + ":" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func TestStorageLoginAttempts(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, s Storage, subject string)
+	}{
+		{
+			name: "failures count up",
+			run: func(t *testing.T, ctx context.Context, s Storage, subject string) {
+				for want := int64(1); want <= 3; want++ {
+					n, err := s.LoginAttempts.Fail(ctx, subject, time.Minute)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if n != want {
+						t.Fatalf("Fail = %d, want %d", n, want)
+					}
+				}
+			},
+		},
+		{
+			name: "failure window starts at the first failure",
+			run: func(t *testing.T, ctx context.Context, s Storage, subject string) {
+				if _, err := s.LoginAttempts.Fail(ctx, subject, time.Second); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.LoginAttempts.Fail(ctx, subject, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+
+				time.Sleep(1500 * time.Millisecond)
+
+				n, err := s.LoginAttempts.Fail(ctx, subject, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != 1 {
+					t.Errorf("Fail after the window = %d, want 1", n)
+				}
+			},
+		},
+		{
+			name: "source window starts at the first source",
+			run: func(t *testing.T, ctx context.Context, s Storage, subject string) {
+				if err := s.LoginAttempts.AddSource(ctx, subject, "10.0.0.1", time.Second); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.LoginAttempts.AddSource(ctx, subject, "10.0.0.2", time.Hour); err != nil {
+					t.Fatal(err)
+				}
+
+				sources, err := s.LoginAttempts.Sources(ctx, subject)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(sources) != 2 {
+					t.Fatalf("Sources = %v, want two", sources)
+				}
+
+				time.Sleep(1500 * time.Millisecond)
+
+				sources, err = s.LoginAttempts.Sources(ctx, subject)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(sources) != 0 {
+					t.Errorf("Sources after the window = %v, want none", sources)
+				}
+			},
+		},
+		{
+			name: "lock and reset",
+			run: func(t *testing.T, ctx context.Context, s Storage, subject string) {
+				if _, err := s.LoginAttempts.LockedUntil(ctx, subject); !errors.Is(err, ErrCacheMiss) {
+					t.Fatalf("LockedUntil before Lock: err = %v, want ErrCacheMiss", err)
+				}
+
+				until := time.Now().Add(time.Hour)
+				if err := s.LoginAttempts.Lock(ctx, subject, until); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := s.LoginAttempts.LockedUntil(ctx, subject)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Unix() != until.Unix() {
+					t.Errorf("LockedUntil = %v, want %v", got, until)
+				}
+
+				if _, err := s.LoginAttempts.Fail(ctx, subject, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.LoginAttempts.AddSource(ctx, subject, "10.0.0.1", time.Minute); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.LoginAttempts.Reset(ctx, subject); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := s.LoginAttempts.LockedUntil(ctx, subject); !errors.Is(err, ErrCacheMiss) {
+					t.Errorf("LockedUntil after Reset: err = %v, want ErrCacheMiss", err)
+				}
+				if sources, _ := s.LoginAttempts.Sources(ctx, subject); len(sources) != 0 {
+					t.Errorf("Sources after Reset = %v", sources)
+				}
+				if n, _ := s.LoginAttempts.Fail(ctx, subject, time.Minute); n != 1 {
+					t.Errorf("Fail after Reset = %d, want 1", n)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			backends(t, func(t *testing.T, s Storage) {
+				tt.run(t, context.Background(), s, uniqueKey(t))
+			})
+		})
+	}
+}
+
+func TestStorageSessions(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, s Storage, userID string)
+	}{
+		{
+			name: "index lives as long as its longest session",
+			run: func(t *testing.T, ctx context.Context, s Storage, userID string) {
+				short := &Session{ID: userID + ":short", UserID: userID, ExpiresAt: time.Now().Add(2 * time.Second)}
+				long := &Session{ID: userID + ":long", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}
+
+				for _, session := range []*Session{short, long} {
+					if err := s.Sessions.SaveSession(ctx, session); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				time.Sleep(2500 * time.Millisecond)
+
+				sessions, err := s.Sessions.ListSessions(ctx, userID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(sessions) != 1 || sessions[0].ID != long.ID {
+					t.Errorf("ListSessions = %v, want only %s", sessions, long.ID)
+				}
+			},
+		},
+		{
+			name: "delete by user",
+			run: func(t *testing.T, ctx context.Context, s Storage, userID string) {
+				session := &Session{
+					ID:         userID + ":1",
+					UserID:     userID,
+					AccessJTI:  userID + ":access",
+					RefreshJTI: userID + ":refresh",
+					ExpiresAt:  time.Now().Add(time.Hour),
+				}
+				if err := s.Sessions.SaveSession(ctx, session); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Sessions.Set(ctx, "access:"+session.AccessJTI, userID, session.ExpiresAt); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := s.Sessions.DeleteByUser(ctx, userID); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := s.Sessions.GetSession(ctx, session.ID); !errors.Is(err, ErrCacheMiss) {
+					t.Errorf("GetSession: err = %v, want ErrCacheMiss", err)
+				}
+				if _, err := s.Sessions.GetUser(ctx, "access:"+session.AccessJTI); !errors.Is(err, ErrCacheMiss) {
+					t.Errorf("GetUser: err = %v, want ErrCacheMiss", err)
+				}
+				if sessions, _ := s.Sessions.ListSessions(ctx, userID); len(sessions) != 0 {
+					t.Errorf("ListSessions = %v, want none", sessions)
+				}
+			},
+		},
+		{
+			name: "refresh tokens retire once",
+			run: func(t *testing.T, ctx context.Context, s Storage, jti string) {
+				exp := time.Now().Add(time.Minute)
+
+				ok, err := s.Sessions.RetireRefreshToken(ctx, jti, "session", exp)
+				if err != nil || !ok {
+					t.Fatalf("first RetireRefreshToken = %v, %v", ok, err)
+				}
+				if ok, _ := s.Sessions.RetireRefreshToken(ctx, jti, "other", exp); ok {
+					t.Error("second RetireRefreshToken succeeded")
+				}
+				if got, _ := s.Sessions.GetRetiredRefreshToken(ctx, jti); got != "session" {
+					t.Errorf("GetRetiredRefreshToken = %q, want session", got)
+				}
+
+				if err := s.Sessions.ReleaseRefreshToken(ctx, jti); err != nil {
+					t.Fatal(err)
+				}
+				if ok, _ := s.Sessions.RetireRefreshToken(ctx, jti, "session", exp); !ok {
+					t.Error("RetireRefreshToken after release failed")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			backends(t, func(t *testing.T, s Storage) {
+				tt.run(t, context.Background(), s, uniqueKey(t))
+			})
+		})
+	}
+}
+
+func TestStorageEphemeral(t *testing.T) {
+	backends(t, func(t *testing.T, s Storage) {
+		ctx := context.Background()
+		key := uniqueKey(t)
+
+		if _, err := s.Ephemeral.Get(ctx, key); !errors.Is(err, ErrCacheMiss) {
+			t.Fatalf("Get before SetNX: err = %v, want ErrCacheMiss", err)
+		}
+
+		if ok, err := s.Ephemeral.SetNX(ctx, key, "first", time.Minute); err != nil || !ok {
+			t.Fatalf("first SetNX = %v, %v", ok, err)
+		}
+		if ok, _ := s.Ephemeral.SetNX(ctx, key, "second", time.Minute); ok {
+			t.Error("second SetNX succeeded")
+		}
+
+		if got, _ := s.Ephemeral.Get(ctx, key); got != "first" {
+			t.Errorf("Get = %q, want first", got)
+		}
+		if got, err := s.Ephemeral.GetDel(ctx, key); err != nil || got != "first" {
+			t.Errorf("GetDel = %q, %v", got, err)
+		}
+		if _, err := s.Ephemeral.GetDel(ctx, key); !errors.Is(err, ErrCacheMiss) {
+			t.Errorf("second GetDel: err = %v, want ErrCacheMiss", err)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type CommentLikeStore struct {
+	db DBTX
+}
+
+type CommentLike struct {
+	UserID    int64     `json:"user_id"`
+	CommentID int64     `json:"comment_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *CommentLikeStore) Create(ctx context.Context, userID, commentID int64) (*CommentLike, error) {
+	var commentLike CommentLike
+	query := `
+	INSERT INTO comment_likes (user_id, comment_id)
+	VALUES ($1, $2)
+	RETURNING user_id, comment_id, created_at`
+
+	err := s.db.QueryRow(ctx, query, userID, commentID).Scan(
+		&commentLike.UserID,
+		&commentLike.CommentID,
+		&commentLike.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commentLike, nil
+}
+
+func (s *CommentLikeStore) Delete(ctx context.Context, userID, commentID int64) error {
+	query := `
+	DELETE FROM comment_likes
+	WHERE user_id = $1 AND comment_id = $2`
+
+	result, err := s.db.Exec(ctx, query, userID, commentID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *CommentLikeStore) ListByUser(ctx context.Context, userID int64) ([]*CommentLike, error) {
+	query := `
+	SELECT user_id, comment_id, created_at
+	FROM comment_likes
+	WHERE user_id = $1
+	ORDER BY created_at`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	likes := []*CommentLike{}
+	for rows.Next() {
+		var like CommentLike
+		if err := rows.Scan(&like.UserID, &like.CommentID, &like.CreatedAt); err != nil {
+			return nil, err
+		}
+		likes = append(likes, &like)
+	}
+
+	return likes, rows.Err()
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type CommentStore struct {
@@ -14,31 +13,39 @@ type CommentStore struct {
 }
 
 type Comment struct {
-	ID              int64          `json:"id"`
-	PostID          int64          `json:"post_id"`
-	UserID          int64          `json:"user_id"`
-	Username        string         `json:"username"`
-	ParentCommentID pgtype.Numeric `json:"parent_comment_id"`
-	Content         string         `json:"content"`
-	Likes           int64          `json:"likes"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
+	ID              int64      `json:"id"`
+	PostID          int64      `json:"post_id"`
+	UserID          int64      `json:"user_id"`
+	Username        string     `json:"username"`
+	ParentCommentID *int64     `json:"parent_comment_id"`
+	Content         string     `json:"content"`
+	Likes           int64      `json:"likes"`
+	ReplyCount      int64      `json:"reply_count"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Replies         []*Comment `json:"replies,omitempty"`
+	// HiddenAt is only loaded by GetByID; List skips hidden comments and
+	// their replies.
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
+	// DeletedAt is set while the comment is in the trash. Every read except
+	// GetDeleted and ListDeleted skips deleted comments and their replies.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy *int64     `json:"deleted_by,omitempty"`
 }
 
-func (s *CommentStore) Create(ctx context.Context, content string, userID, postID int64) (*Comment, error) {
+func (s *CommentStore) Create(ctx context.Context, content string, userID, postID int64, parentCommentID *int64) (*Comment, error) {
 	var comment Comment
 	query := `
-	INSERT INTO comments (content, user_id, post_id)
-	VALUES ($1, $2, $3)
-	RETURNING id, post_id, user_id, parent_comment_id, content, likes, created_at, updated_at`
+	INSERT INTO comments (content, user_id, post_id, parent_comment_id)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, post_id, user_id, parent_comment_id, content, created_at, updated_at`
 
-	err := s.db.QueryRow(ctx, query, content, userID, postID).Scan(
+	err := s.db.QueryRow(ctx, query, content, userID, postID, parentCommentID).Scan(
 		&comment.ID,
 		&comment.PostID,
 		&comment.UserID,
 		&comment.ParentCommentID,
 		&comment.Content,
-		&comment.Likes,
 		&comment.CreatedAt,
 		&comment.UpdatedAt,
 	)
@@ -50,14 +57,26 @@ func (s *CommentStore) Create(ctx context.Context, content string, userID, postI
 }
 
 func (s *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
+	return s.getByID(ctx, commentID, false)
+}
+
+// GetDeleted loads a comment that is in the trash.
+func (s *CommentStore) GetDeleted(ctx context.Context, commentID int64) (*Comment, error) {
+	return s.getByID(ctx, commentID, true)
+}
+
+func (s *CommentStore) getByID(ctx context.Context, commentID int64, deleted bool) (*Comment, error) {
 	var comment Comment
 	query := `
-	SELECT c.id, c.post_id, c.user_id, u.name, c.parent_comment_id, c.content, c.likes, c.created_at, c.updated_at
+	SELECT c.id, c.post_id, c.user_id, u.name, c.parent_comment_id, c.content,
+	(SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = c.id) AS likes,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = c.id AND r.hidden_at IS NULL AND r.deleted_at IS NULL) AS reply_count,
+	c.created_at, c.updated_at, c.hidden_at, c.deleted_at, c.deleted_by
 	FROM comments c
 	LEFT JOIN users u ON c.user_id = u.id
-	WHERE c.id = $1`
+	WHERE c.id = $1 AND (c.deleted_at IS NOT NULL) = $2`
 
-	err := s.db.QueryRow(ctx, query, commentID).Scan(
+	err := s.db.QueryRow(ctx, query, commentID, deleted).Scan(
 		&comment.ID,
 		&comment.PostID,
 		&comment.UserID,
@@ -65,8 +84,12 @@ func (s *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment,
 		&comment.ParentCommentID,
 		&comment.Content,
 		&comment.Likes,
+		&comment.ReplyCount,
 		&comment.CreatedAt,
 		&comment.UpdatedAt,
+		&comment.HiddenAt,
+		&comment.DeletedAt,
+		&comment.DeletedBy,
 	)
 	if err != nil {
 		switch {
@@ -85,8 +108,11 @@ func (s *CommentStore) Update(ctx context.Context, content string, commentID int
 	query := `
 	UPDATE comments
 	SET content = $1
-	WHERE id = $2
-	RETURNING id, post_id, user_id, parent_comment_id, content, likes, created_at, updated_at`
+	WHERE id = $2 AND deleted_at IS NULL
+	RETURNING id, post_id, user_id, parent_comment_id, content,
+	(SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = comments.id),
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = comments.id AND r.hidden_at IS NULL AND r.deleted_at IS NULL),
+	created_at, updated_at`
 
 	err := s.db.QueryRow(ctx, query, content, commentID).Scan(
 		&comment.ID,
@@ -95,6 +121,7 @@ func (s *CommentStore) Update(ctx context.Context, content string, commentID int
 		&comment.ParentCommentID,
 		&comment.Content,
 		&comment.Likes,
+		&comment.ReplyCount,
 		&comment.CreatedAt,
 		&comment.UpdatedAt,
 	)
@@ -105,10 +132,121 @@ func (s *CommentStore) Update(ctx context.Context, content string, commentID int
 	return &comment, nil
 }
 
-func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+// Delete moves the comment to the trash. Its replies stay put but can't be
+// reached until the comment is restored.
+func (s *CommentStore) Delete(ctx context.Context, commentID, deletedBy int64) error {
+	query := `
+	UPDATE comments
+	SET deleted_at = NOW(), deleted_by = $2
+	WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, commentID, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Restore takes the comment back out of the trash.
+func (s *CommentStore) Restore(ctx context.Context, commentID int64) error {
+	query := `
+	UPDATE comments
+	SET deleted_at = NULL, deleted_by = NULL
+	WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	result, err := s.db.Exec(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListDeleted returns the user's deleted comments, most recently deleted
+// first.
+func (s *CommentStore) ListDeleted(ctx context.Context, userID int64) ([]*Comment, error) {
+	query := `
+	SELECT id, post_id, user_id, parent_comment_id, content, created_at, updated_at, deleted_at, deleted_by
+	FROM comments
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.UserID,
+			&comment.ParentCommentID,
+			&comment.Content,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+			&comment.DeletedAt,
+			&comment.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// PurgeDeletedBefore removes comments that went to the trash before the given
+// time for good, replies included, and returns how many were removed.
+func (s *CommentStore) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
 	query := `
 	DELETE FROM comments
-	WHERE id = $1`
+	WHERE deleted_at < $1`
+
+	result, err := s.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (s *CommentStore) Hide(ctx context.Context, commentID int64) error {
+	query := `
+	UPDATE comments
+	SET hidden_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Unhide puts a hidden comment back under its post.
+func (s *CommentStore) Unhide(ctx context.Context, commentID int64) error {
+	query := `
+	UPDATE comments
+	SET hidden_at = NULL
+	WHERE id = $1 AND hidden_at IS NOT NULL AND deleted_at IS NULL`
 
 	result, err := s.db.Exec(ctx, query, commentID)
 	if err != nil {
@@ -122,25 +260,30 @@ func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
 	return nil
 }
 
-func (s *CommentStore) List(ctx context.Context, postID int64, sortBy string, limit, offset int64) (int64, []*Comment, error) {
+// List returns a page of top-level comments for a post together with their
+// replies, nested up to depth levels below each top-level comment.
+func (s *CommentStore) List(ctx context.Context, postID int64, sortBy string, depth, limit, offset int64) (int64, []*Comment, error) {
 	var count int64
-	query := `SELECT COUNT(*) FROM comments WHERE post_id = $1`
+	query := `SELECT COUNT(*) FROM comments WHERE post_id = $1 AND parent_comment_id IS NULL AND hidden_at IS NULL AND deleted_at IS NULL`
 	if err := s.db.QueryRow(ctx, query, postID).Scan(&count); err != nil {
 		return -1, nil, err
 	}
 
 	var comments []*Comment
 	query = `
-	SELECT c.id, c.post_id, c.user_id, u.name, c.parent_comment_id, c.content, c.likes, c.created_at, c.updated_at
+	SELECT c.id, c.post_id, c.user_id, u.name, c.parent_comment_id, c.content,
+	(SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = c.id) AS likes,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = c.id AND r.hidden_at IS NULL AND r.deleted_at IS NULL) AS reply_count,
+	c.created_at, c.updated_at
 	FROM comments c
 	LEFT JOIN users u ON c.user_id = u.id
-	WHERE post_id = $1`
+	WHERE post_id = $1 AND c.parent_comment_id IS NULL AND c.hidden_at IS NULL AND c.deleted_at IS NULL`
 
 	switch sortBy {
 	case "oldest":
 		query += " ORDER BY created_at ASC"
 	case "popular":
-		query += " ORDER BY likes DESC"
+		query += " ORDER BY likes DESC, created_at DESC"
 	default:
 		query += " ORDER BY created_at DESC"
 	}
@@ -151,6 +294,10 @@ func (s *CommentStore) List(ctx context.Context, postID int64, sortBy string, li
 	if err != nil {
 		return -1, nil, err
 	}
+	defer rows.Close()
+
+	byID := make(map[int64]*Comment)
+	rootIDs := make([]int64, 0, limit)
 
 	for rows.Next() {
 		var comment Comment
@@ -162,6 +309,7 @@ func (s *CommentStore) List(ctx context.Context, postID int64, sortBy string, li
 			&comment.ParentCommentID,
 			&comment.Content,
 			&comment.Likes,
+			&comment.ReplyCount,
 			&comment.CreatedAt,
 			&comment.UpdatedAt,
 		); err != nil {
@@ -169,7 +317,108 @@ func (s *CommentStore) List(ctx context.Context, postID int64, sortBy string, li
 		}
 
 		comments = append(comments, &comment)
+		byID[comment.ID] = &comment
+		rootIDs = append(rootIDs, comment.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	if depth <= 0 || len(rootIDs) == 0 {
+		return count, comments, nil
+	}
+
+	query = `
+	WITH RECURSIVE thread AS (
+		SELECT c.*, 1 AS depth
+		FROM comments c
+		WHERE c.parent_comment_id = ANY($1) AND c.hidden_at IS NULL AND c.deleted_at IS NULL
+		UNION ALL
+		SELECT c.*, t.depth + 1
+		FROM comments c
+		JOIN thread t ON c.parent_comment_id = t.id
+		WHERE t.depth < $2 AND c.hidden_at IS NULL AND c.deleted_at IS NULL
+	)
+	SELECT t.id, t.post_id, t.user_id, u.name, t.parent_comment_id, t.content,
+	(SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = t.id) AS likes,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = t.id AND r.hidden_at IS NULL AND r.deleted_at IS NULL) AS reply_count,
+	t.created_at, t.updated_at
+	FROM thread t
+	LEFT JOIN users u ON t.user_id = u.id
+	ORDER BY t.depth ASC, t.created_at ASC`
+
+	replyRows, err := s.db.Query(ctx, query, rootIDs, depth)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer replyRows.Close()
+
+	for replyRows.Next() {
+		var reply Comment
+		if err := replyRows.Scan(
+			&reply.ID,
+			&reply.PostID,
+			&reply.UserID,
+			&reply.Username,
+			&reply.ParentCommentID,
+			&reply.Content,
+			&reply.Likes,
+			&reply.ReplyCount,
+			&reply.CreatedAt,
+			&reply.UpdatedAt,
+		); err != nil {
+			return -1, nil, err
+		}
+
+		// Rows are ordered by depth, so a reply's parent is always seen first.
+		parent, ok := byID[*reply.ParentCommentID]
+		if !ok {
+			continue
+		}
+		parent.Replies = append(parent.Replies, &reply)
+		byID[reply.ID] = &reply
+	}
+	if err := replyRows.Err(); err != nil {
+		return -1, nil, err
 	}
 
 	return count, comments, nil
 }
+
+func (s *CommentStore) ListByUser(ctx context.Context, userID int64) ([]*Comment, error) {
+	query := `
+	SELECT c.id, c.post_id, c.user_id, u.name, c.parent_comment_id, c.content,
+	(SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = c.id) AS likes,
+	c.created_at, c.updated_at
+	FROM comments c
+	JOIN users u ON u.id = c.user_id
+	WHERE c.user_id = $1 AND c.deleted_at IS NULL
+	ORDER BY c.created_at`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.UserID,
+			&comment.Username,
+			&comment.ParentCommentID,
+			&comment.Content,
+			&comment.Likes,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+
+	return comments, rows.Err()
+}
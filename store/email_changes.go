@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EmailChange is an address a user asked to switch to. It is applied once
+// the user follows the ScopeEmailChange token sent to the new address.
+type EmailChange struct {
+	UserID    int64     `json:"user_id"`
+	NewEmail  string    `json:"new_email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type EmailChangeStore struct {
+	db DBTX
+}
+
+// Create replaces any pending change for the user.
+func (s *EmailChangeStore) Create(ctx context.Context, userID int64, newEmail string) (*EmailChange, error) {
+	var change EmailChange
+	query := `
+	INSERT INTO user_email_changes (user_id, new_email)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET new_email = EXCLUDED.new_email, created_at = NOW()
+	RETURNING user_id, new_email, created_at`
+
+	err := s.db.QueryRow(ctx, query, userID, newEmail).Scan(
+		&change.UserID,
+		&change.NewEmail,
+		&change.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// Take removes the pending change and returns it.
+func (s *EmailChangeStore) Take(ctx context.Context, userID int64) (*EmailChange, error) {
+	var change EmailChange
+	query := `
+	DELETE FROM user_email_changes
+	WHERE user_id = $1
+	RETURNING user_id, new_email, created_at`
+
+	err := s.db.QueryRow(ctx, query, userID).Scan(
+		&change.UserID,
+		&change.NewEmail,
+		&change.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &change, nil
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Export is a GDPR data export. The archive is built in the background and
+// kept in object storage under ObjectKey until ExpiresAt.
+type Export struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	ObjectKey   *string    `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+type ExportStore struct {
+	db DBTX
+}
+
+func (s *ExportStore) Create(ctx context.Context, userID int64, expiresAt time.Time) (*Export, error) {
+	export := &Export{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Status:    ExportPending,
+		ExpiresAt: expiresAt,
+	}
+
+	query := `
+	INSERT INTO user_exports (id, user_id, status, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING created_at`
+
+	err := s.db.QueryRow(ctx, query, export.ID, export.UserID, export.Status, export.ExpiresAt).Scan(&export.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *ExportStore) GetByID(ctx context.Context, id uuid.UUID, userID int64) (*Export, error) {
+	var export Export
+	query := `
+	SELECT id, user_id, status, object_key, created_at, completed_at, expires_at
+	FROM user_exports
+	WHERE id = $1 AND user_id = $2 AND expires_at > NOW()`
+
+	err := s.db.QueryRow(ctx, query, id, userID).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.ObjectKey,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// GetLatest returns the user's newest unexpired export that hasn't failed.
+func (s *ExportStore) GetLatest(ctx context.Context, userID int64) (*Export, error) {
+	var export Export
+	query := `
+	SELECT id, user_id, status, object_key, created_at, completed_at, expires_at
+	FROM user_exports
+	WHERE user_id = $1 AND status <> $2 AND expires_at > NOW()
+	ORDER BY created_at DESC
+	LIMIT 1`
+
+	err := s.db.QueryRow(ctx, query, userID, ExportFailed).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.ObjectKey,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+func (s *ExportStore) MarkReady(ctx context.Context, id uuid.UUID, objectKey string) error {
+	query := `
+	UPDATE user_exports
+	SET status = $1, object_key = $2, completed_at = NOW()
+	WHERE id = $3`
+
+	_, err := s.db.Exec(ctx, query, ExportReady, objectKey, id)
+	return err
+}
+
+func (s *ExportStore) MarkFailed(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE user_exports
+	SET status = $1, completed_at = NOW()
+	WHERE id = $2`
+
+	_, err := s.db.Exec(ctx, query, ExportFailed, id)
+	return err
+}
+
+func (s *ExportStore) ListExpired(ctx context.Context, limit int64) ([]*Export, error) {
+	query := `
+	SELECT id, user_id, status, object_key, created_at, completed_at, expires_at
+	FROM user_exports
+	WHERE expires_at <= NOW()
+	LIMIT $1`
+
+	return s.list(ctx, query, limit)
+}
+
+func (s *ExportStore) ListByUser(ctx context.Context, userID int64) ([]*Export, error) {
+	query := `
+	SELECT id, user_id, status, object_key, created_at, completed_at, expires_at
+	FROM user_exports
+	WHERE user_id = $1`
+
+	return s.list(ctx, query, userID)
+}
+
+func (s *ExportStore) list(ctx context.Context, query string, args ...any) ([]*Export, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []*Export
+	for rows.Next() {
+		var export Export
+		if err := rows.Scan(
+			&export.ID,
+			&export.UserID,
+			&export.Status,
+			&export.ObjectKey,
+			&export.CreatedAt,
+			&export.CompletedAt,
+			&export.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		exports = append(exports, &export)
+	}
+
+	return exports, rows.Err()
+}
+
+func (s *ExportStore) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM user_exports WHERE id = $1`
+
+	_, err := s.db.Exec(ctx, query, id)
+	return err
+}
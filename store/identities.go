@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Identity links a user to an account at an external OpenID Connect
+// provider. Subject is the provider's stable "sub" claim.
+type Identity struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"-"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+type IdentityStore struct {
+	db DBTX
+}
+
+func (s *IdentityStore) Create(ctx context.Context, identity *Identity) error {
+	query := `
+	INSERT INTO user_identities (user_id, provider, subject, email)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, last_login_at`
+
+	return s.db.QueryRow(ctx, query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+}
+
+// GetBySubject looks an identity up and records the login against it.
+func (s *IdentityStore) GetBySubject(ctx context.Context, provider, subject string) (*Identity, error) {
+	var identity Identity
+	query := `
+	UPDATE user_identities
+	SET last_login_at = NOW()
+	WHERE provider = $1 AND subject = $2
+	RETURNING id, user_id, provider, subject, email, created_at, last_login_at`
+
+	err := s.db.QueryRow(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &identity, nil
+}
+
+func (s *IdentityStore) ListByUser(ctx context.Context, userID int64) ([]*Identity, error) {
+	query := `
+	SELECT id, user_id, provider, subject, email, created_at, last_login_at
+	FROM user_identities
+	WHERE user_id = $1
+	ORDER BY created_at`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		var identity Identity
+		if err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+			&identity.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+
+	return identities, rows.Err()
+}
+
+func (s *IdentityStore) DeleteByUser(ctx context.Context, userID int64) error {
+	query := `DELETE FROM user_identities WHERE user_id = $1`
+
+	_, err := s.db.Exec(ctx, query, userID)
+	return err
+}
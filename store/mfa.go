@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const recoveryCodeCount = 10
+
+type TOTP struct {
+	UserID       int64      `json:"user_id"`
+	Secret       string     `json:"-"`
+	LastUsedStep int64      `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type MFAStore struct {
+	db DBTX
+}
+
+// GenerateRecoveryCodes returns plaintext codes to show the user once and the
+// hashes to store, in the same order.
+func GenerateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		randomBytes := make([]byte, 5)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+		code := raw[:4] + "-" + raw[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func HashRecoveryCode(code string) []byte {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
+
+func (s *MFAStore) CreateTOTP(ctx context.Context, userID int64, secret string) (*TOTP, error) {
+	var totp TOTP
+	query := `
+	INSERT INTO user_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, last_used_step = 0, confirmed_at = NULL, created_at = NOW()
+	WHERE user_totp.confirmed_at IS NULL
+	RETURNING user_id, secret, last_used_step, confirmed_at, created_at`
+
+	err := s.db.QueryRow(ctx, query, userID, secret).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.LastUsedStep,
+		&totp.ConfirmedAt,
+		&totp.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrConflict
+		default:
+			return nil, err
+		}
+	}
+
+	return &totp, nil
+}
+
+func (s *MFAStore) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	var totp TOTP
+	query := `
+	SELECT user_id, secret, last_used_step, confirmed_at, created_at
+	FROM user_totp
+	WHERE user_id = $1`
+
+	err := s.db.QueryRow(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.LastUsedStep,
+		&totp.ConfirmedAt,
+		&totp.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &totp, nil
+}
+
+func (s *MFAStore) ConfirmTOTP(ctx context.Context, userID int64) error {
+	query := `
+	UPDATE user_totp
+	SET confirmed_at = NOW()
+	WHERE user_id = $1 AND confirmed_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	query = `UPDATE users SET mfa_enabled = true WHERE id = $1`
+	_, err = s.db.Exec(ctx, query, userID)
+	return err
+}
+
+// UseStep records the time step of an accepted code. It fails with
+// ErrConflict if that step, or a later one, was already used, which stops a
+// code from being replayed inside its validity window.
+func (s *MFAStore) UseStep(ctx context.Context, userID, step int64) error {
+	query := `
+	UPDATE user_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND last_used_step < $2`
+
+	result, err := s.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+func (s *MFAStore) DeleteTOTP(ctx context.Context, userID int64) error {
+	query := `DELETE FROM user_totp WHERE user_id = $1`
+	if _, err := s.db.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM user_recovery_codes WHERE user_id = $1`
+	if _, err := s.db.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `UPDATE users SET mfa_enabled = false WHERE id = $1`
+	_, err := s.db.Exec(ctx, query, userID)
+	return err
+}
+
+func (s *MFAStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte) error {
+	query := `DELETE FROM user_recovery_codes WHERE user_id = $1`
+	if _, err := s.db.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO user_recovery_codes (user_id, code_hash)
+	SELECT $1, UNNEST($2::bytea[])`
+
+	_, err := s.db.Exec(ctx, query, userID, hashes)
+	return err
+}
+
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error {
+	query := `
+	UPDATE user_recovery_codes
+	SET used_at = NOW()
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, userID, hash)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
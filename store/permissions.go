@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Permissions name what a role may do beyond acting on its own content.
+const (
+	PermPostUpdateAny   = "post.update.any"
+	PermPostDeleteAny   = "post.delete.any"
+	PermCommentModerate = "comment.moderate"
+	PermTagCreate       = "tag.create"
+	PermTagDelete       = "tag.delete"
+	PermUserManage      = "user.manage"
+	PermRoleManage      = "role.manage"
+	PermReportModerate  = "report.moderate"
+	PermAuditRead       = "audit.read"
+)
+
+type Permission struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type PermissionStore struct {
+	db DBTX
+}
+
+func (s *PermissionStore) List(ctx context.Context) ([]*Permission, error) {
+	query := `
+	SELECT id, name, description, created_at
+	FROM permissions
+	ORDER BY name`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*Permission{}
+	for rows.Next() {
+		var permission Permission
+		if err := rows.Scan(
+			&permission.ID,
+			&permission.Name,
+			&permission.Description,
+			&permission.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &permission)
+	}
+
+	return permissions, rows.Err()
+}
@@ -108,3 +108,35 @@ func (s *PostFileStore) Delete(ctx context.Context, fileID uuid.UUID) error {
 
 	return nil
 }
+
+func (s *PostFileStore) ListByUser(ctx context.Context, userID int64) ([]*PostFile, error) {
+	query := `
+	SELECT pf.file_id, pf.file_extension, pf.original_filename, pf.post_id, pf.created_at
+	FROM post_files pf
+	JOIN posts p ON p.id = pf.post_id
+	WHERE p.user_id = $1 AND p.deleted_at IS NULL
+	ORDER BY pf.created_at`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	postFiles := []*PostFile{}
+	for rows.Next() {
+		var postFile PostFile
+		if err := rows.Scan(
+			&postFile.FileID,
+			&postFile.FileExtension,
+			&postFile.OriginalFilename,
+			&postFile.PostID,
+			&postFile.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		postFiles = append(postFiles, &postFile)
+	}
+
+	return postFiles, rows.Err()
+}
@@ -50,3 +50,28 @@ func (s *PostLikeStore) Delete(ctx context.Context, userID, postID int64) error
 
 	return nil
 }
+
+func (s *PostLikeStore) ListByUser(ctx context.Context, userID int64) ([]*PostLike, error) {
+	query := `
+	SELECT user_id, post_id, created_at
+	FROM post_likes
+	WHERE user_id = $1
+	ORDER BY created_at`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	likes := []*PostLike{}
+	for rows.Next() {
+		var like PostLike
+		if err := rows.Scan(&like.UserID, &like.PostID, &like.CreatedAt); err != nil {
+			return nil, err
+		}
+		likes = append(likes, &like)
+	}
+
+	return likes, rows.Err()
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PostRevision is the title and content of a post as of one edit. Revision 1
+// is the post as first published.
+type PostRevision struct {
+	ID         int64  `json:"id"`
+	PostID     int64  `json:"post_id"`
+	Revision   int64  `json:"revision"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	EditorID   *int64 `json:"editor_id"`
+	EditorName string `json:"editor_name"`
+	// RedactedAt is set once a moderator has blanked the revision's title
+	// and content.
+	RedactedAt *time.Time `json:"redacted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type PostRevisionStore struct {
+	db DBTX
+}
+
+// Create records the next revision of the post. Run it in the same
+// transaction as the change to the post, whose row lock keeps two edits from
+// taking the same number.
+func (s *PostRevisionStore) Create(ctx context.Context, revision *PostRevision) error {
+	query := `
+	INSERT INTO post_revisions (post_id, revision, title, content, editor_id)
+	VALUES ($1, (SELECT COALESCE(MAX(revision), 0) + 1 FROM post_revisions WHERE post_id = $1), $2, $3, $4)
+	RETURNING id, revision, created_at`
+
+	return s.db.QueryRow(ctx, query,
+		revision.PostID,
+		revision.Title,
+		revision.Content,
+		revision.EditorID,
+	).Scan(&revision.ID, &revision.Revision, &revision.CreatedAt)
+}
+
+// List returns every revision of the post, newest first.
+func (s *PostRevisionStore) List(ctx context.Context, postID int64) ([]*PostRevision, error) {
+	query := `
+	SELECT r.id, r.post_id, r.revision, r.title, r.content, r.editor_id, COALESCE(u.name, ''), r.redacted_at, r.created_at
+	FROM post_revisions r
+	LEFT JOIN users u ON u.id = r.editor_id
+	WHERE r.post_id = $1
+	ORDER BY r.revision DESC`
+
+	rows, err := s.db.Query(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*PostRevision{}
+	for rows.Next() {
+		var revision PostRevision
+		if err := rows.Scan(
+			&revision.ID,
+			&revision.PostID,
+			&revision.Revision,
+			&revision.Title,
+			&revision.Content,
+			&revision.EditorID,
+			&revision.EditorName,
+			&revision.RedactedAt,
+			&revision.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *PostRevisionStore) Get(ctx context.Context, postID, revision int64) (*PostRevision, error) {
+	var r PostRevision
+	query := `
+	SELECT r.id, r.post_id, r.revision, r.title, r.content, r.editor_id, COALESCE(u.name, ''), r.redacted_at, r.created_at
+	FROM post_revisions r
+	LEFT JOIN users u ON u.id = r.editor_id
+	WHERE r.post_id = $1 AND r.revision = $2`
+
+	err := s.db.QueryRow(ctx, query, postID, revision).Scan(
+		&r.ID,
+		&r.PostID,
+		&r.Revision,
+		&r.Title,
+		&r.Content,
+		&r.EditorID,
+		&r.EditorName,
+		&r.RedactedAt,
+		&r.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
+
+// Redact blanks the title and content of a revision, for when an edit took
+// out something that shouldn't stay readable in the history.
+func (s *PostRevisionStore) Redact(ctx context.Context, postID, revision, redactedBy int64) error {
+	query := `
+	UPDATE post_revisions
+	SET title = '', content = '', redacted_at = NOW(), redacted_by = $3
+	WHERE post_id = $1 AND revision = $2 AND redacted_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, postID, revision, redactedBy)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -10,18 +10,29 @@ import (
 )
 
 type Post struct {
-	ID                int64       `json:"id"`
-	Title             string      `json:"title"`
-	Content           string      `json:"content"`
-	UserID            int64       `json:"user_id"`
-	CreatedAt         time.Time   `json:"created_at"`
-	UpdatedAt         time.Time   `json:"updated_at"`
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Edited is set once the title or content has changed since the post
+	// was published; PostRevisions has what it said before.
+	Edited            bool        `json:"edited"`
+	EditedAt          *time.Time  `json:"edited_at"`
 	Likes             int64       `json:"likes"`
 	Username          string      `json:"username"`
 	FileIDs           []uuid.UUID `json:"file_ids"`
 	FileExtensions    []string    `json:"file_extensions"`
 	OriginalFilenames []string    `json:"original_filenames"`
 	Tags              []string    `json:"tags"`
+	// HiddenAt is set when a moderator hid the post. Only GetByID and
+	// GetByUserID load it; the feeds, tags and search skip hidden posts.
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
+	// DeletedAt is set while the post is in the trash. Every read except
+	// GetDeleted and ListDeleted skips deleted posts.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy *int64     `json:"deleted_by,omitempty"`
 }
 
 type PostStore struct {
@@ -54,7 +65,7 @@ func (s *PostStore) Create(ctx context.Context, title, content string, userID in
 func (s *PostStore) GetByUserID(ctx context.Context, userID int64) ([]*Post, error) {
 	var posts []*Post
 	query := `
-	SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, COUNT(pl.post_id), u.name,
+	SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, p.edited_at IS NOT NULL, p.edited_at, COUNT(pl.post_id), u.name, p.hidden_at,
 	ARRAY_AGG(pf.file_id) FILTER (WHERE pf.file_id IS NOT NULL) as file_ids,
 	ARRAY_AGG(pf.file_extension) FILTER (WHERE pf.file_extension IS NOT NULL) as file_extensions,
 	ARRAY_AGG(pf.original_filename) FILTER (WHERE pf.original_filename IS NOT NULL) as original_filenames,
@@ -64,7 +75,7 @@ func (s *PostStore) GetByUserID(ctx context.Context, userID int64) ([]*Post, err
 	LEFT JOIN post_files pf ON pf.post_id = p.id
 	LEFT JOIN post_likes pl ON pl.post_id = p.id
 	LEFT JOIN post_tags pt ON pt.post_id = p.id
-	WHERE p.user_id = $1
+	WHERE p.user_id = $1 AND p.deleted_at IS NULL
 	GROUP BY p.id, u.name`
 
 	rows, err := s.db.Query(ctx, query, userID)
@@ -86,8 +97,11 @@ func (s *PostStore) GetByUserID(ctx context.Context, userID int64) ([]*Post, err
 			&post.UserID,
 			&post.CreatedAt,
 			&post.UpdatedAt,
+			&post.Edited,
+			&post.EditedAt,
 			&post.Likes,
 			&post.Username,
+			&post.HiddenAt,
 			&post.FileIDs,
 			&post.FileExtensions,
 			&post.OriginalFilenames,
@@ -102,9 +116,18 @@ func (s *PostStore) GetByUserID(ctx context.Context, userID int64) ([]*Post, err
 }
 
 func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
+	return s.getByID(ctx, id, false)
+}
+
+// GetDeleted loads a post that is in the trash.
+func (s *PostStore) GetDeleted(ctx context.Context, id int64) (*Post, error) {
+	return s.getByID(ctx, id, true)
+}
+
+func (s *PostStore) getByID(ctx context.Context, id int64, deleted bool) (*Post, error) {
 	var post Post
 	query := `
-	SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, COUNT(pl.post_id), u.name,
+	SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, p.edited_at IS NOT NULL, p.edited_at, COUNT(pl.post_id), u.name, p.hidden_at, p.deleted_at, p.deleted_by,
 	ARRAY_AGG(pf.file_id) FILTER (WHERE pf.file_id IS NOT NULL) as file_ids,
 	ARRAY_AGG(pf.file_extension) FILTER (WHERE pf.file_extension IS NOT NULL) as file_extensions,
 	ARRAY_AGG(pf.original_filename) FILTER (WHERE pf.original_filename IS NOT NULL) as original_filenames,
@@ -114,18 +137,23 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	LEFT JOIN post_files pf ON pf.post_id = p.id
 	LEFT JOIN post_likes pl ON pl.post_id = p.id
 	LEFT JOIN post_tags pt ON pt.post_id = p.id
-	WHERE p.id = $1
+	WHERE p.id = $1 AND (p.deleted_at IS NOT NULL) = $2
 	GROUP BY p.id, u.name`
 
-	err := s.db.QueryRow(ctx, query, id).Scan(
+	err := s.db.QueryRow(ctx, query, id, deleted).Scan(
 		&post.ID,
 		&post.Title,
 		&post.Content,
 		&post.UserID,
 		&post.CreatedAt,
 		&post.UpdatedAt,
+		&post.Edited,
+		&post.EditedAt,
 		&post.Likes,
 		&post.Username,
+		&post.HiddenAt,
+		&post.DeletedAt,
+		&post.DeletedBy,
 		&post.FileIDs,
 		&post.FileExtensions,
 		&post.OriginalFilenames,
@@ -143,31 +171,145 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	return &post, nil
 }
 
-func (s *PostStore) Update(ctx context.Context, content string, id int64) (*Post, error) {
+// Update changes the title and content and marks the post as edited. Record
+// the new revision with PostRevisions in the same transaction.
+func (s *PostStore) Update(ctx context.Context, title, content string, id int64) (*Post, error) {
 	var post Post
 	query := `
 	UPDATE posts
-	SET content = $1
-	WHERE id = $2
-	RETURNING id, content, created_at, updated_at`
+	SET title = $1, content = $2, edited_at = NOW()
+	WHERE id = $3 AND deleted_at IS NULL
+	RETURNING id, title, content, user_id, created_at, updated_at, edited_at IS NOT NULL, edited_at`
 
-	err := s.db.QueryRow(ctx, query, content, id).Scan(
+	err := s.db.QueryRow(ctx, query, title, content, id).Scan(
 		&post.ID,
+		&post.Title,
 		&post.Content,
+		&post.UserID,
 		&post.CreatedAt,
 		&post.UpdatedAt,
+		&post.Edited,
+		&post.EditedAt,
 	)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &post, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, id int64) error {
+// Delete moves the post to the trash. Its files stay in storage until Purge.
+func (s *PostStore) Delete(ctx context.Context, id, deletedBy int64) error {
+	query := `
+	UPDATE posts
+	SET deleted_at = NOW(), deleted_by = $2
+	WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, id, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Restore takes the post back out of the trash.
+func (s *PostStore) Restore(ctx context.Context, id int64) error {
+	query := `
+	UPDATE posts
+	SET deleted_at = NULL, deleted_by = NULL
+	WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	result, err := s.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListDeleted returns the user's deleted posts, most recently deleted first.
+func (s *PostStore) ListDeleted(ctx context.Context, userID int64) ([]*Post, error) {
+	query := `
+	SELECT id, title, content, user_id, created_at, updated_at, deleted_at, deleted_by
+	FROM posts
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(
+			&post.ID,
+			&post.Title,
+			&post.Content,
+			&post.UserID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.DeletedAt,
+			&post.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+
+	return posts, rows.Err()
+}
+
+// ListDeletedBefore returns the IDs of posts that went to the trash before
+// the given time.
+func (s *PostStore) ListDeletedBefore(ctx context.Context, before time.Time, limit int64) ([]int64, error) {
+	query := `
+	SELECT id
+	FROM posts
+	WHERE deleted_at < $1
+	ORDER BY deleted_at
+	LIMIT $2`
+
+	rows, err := s.db.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var postIDs []int64
+	for rows.Next() {
+		var postID int64
+		if err := rows.Scan(&postID); err != nil {
+			return nil, err
+		}
+		postIDs = append(postIDs, postID)
+	}
+
+	return postIDs, rows.Err()
+}
+
+// Purge removes a post in the trash for good, along with everything that
+// references it.
+func (s *PostStore) Purge(ctx context.Context, id int64) error {
 	query := `
 	DELETE FROM posts
-	WHERE id = $1`
+	WHERE id = $1 AND deleted_at IS NOT NULL`
 
 	result, err := s.db.Exec(ctx, query, id)
 	if err != nil {
@@ -187,6 +329,44 @@ type PostWithMetadata struct {
 	ImageLinks   []string `json:"image_links"`
 }
 
+// Hide takes the post out of every listing without deleting it.
+func (s *PostStore) Hide(ctx context.Context, id int64) error {
+	query := `
+	UPDATE posts
+	SET hidden_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Unhide puts a hidden post back in the listings.
+func (s *PostStore) Unhide(ctx context.Context, id int64) error {
+	query := `
+	UPDATE posts
+	SET hidden_at = NULL
+	WHERE id = $1 AND hidden_at IS NOT NULL AND deleted_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 func (s *PostStore) GetUserFeed(ctx context.Context, userID, limit, offset int64) ([]*PostWithMetadata, error) {
 	var postsWithMetadata []*PostWithMetadata
 	query := `
@@ -198,6 +378,8 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID, limit, offset int64
        	u.name,
        	p.created_at,
         p.updated_at,
+        p.edited_at IS NOT NULL,
+        p.edited_at,
         COUNT(DISTINCT pl.post_id) AS like_count,
         COUNT(DISTINCT c.id) AS comment_count,
         ARRAY_AGG(pf.file_id) FILTER (WHERE pf.file_id IS NOT NULL) as file_ids,
@@ -206,12 +388,15 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID, limit, offset int64
 		ARRAY_AGG(DISTINCT pt.tag_name) FILTER (WHERE pt.tag_name IS NOT NULL) as tags
     FROM posts p
     LEFT JOIN users u ON u.id = p.user_id
-    LEFT JOIN comments c ON c.post_id = p.id
+    LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL
     LEFT JOIN post_likes pl ON pl.post_id = p.id
     LEFT JOIN post_tags pt ON pt.post_id = p.id
     LEFT JOIN post_files pf ON pf.post_id = p.id
     WHERE
-    	p.user_id = $1
+    	p.hidden_at IS NULL
+    	AND p.deleted_at IS NULL
+    	AND (p.user_id = $1
+    	OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1))
     GROUP BY p.id, p.content, p.user_id, u.name, p.created_at, p.updated_at
     ORDER BY p.created_at DESC
     LIMIT $2 OFFSET $3;`
@@ -231,6 +416,8 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID, limit, offset int64
 			&postWithMetadata.Post.Username,
 			&postWithMetadata.Post.CreatedAt,
 			&postWithMetadata.Post.UpdatedAt,
+			&postWithMetadata.Post.Edited,
+			&postWithMetadata.Post.EditedAt,
 			&postWithMetadata.Post.Likes,
 			&postWithMetadata.CommentCount,
 			&postWithMetadata.Post.FileIDs,
@@ -257,6 +444,8 @@ func (s *PostStore) GetPublicFeed(ctx context.Context, limit, offset int64) ([]*
        	u.name,
        	p.created_at,
         p.updated_at,
+        p.edited_at IS NOT NULL,
+        p.edited_at,
         COUNT(DISTINCT pl.post_id) AS like_count,
         COUNT(DISTINCT c.id) AS comment_count,
         ARRAY_AGG(pf.file_id) FILTER (WHERE pf.file_id IS NOT NULL) as file_ids,
@@ -265,10 +454,11 @@ func (s *PostStore) GetPublicFeed(ctx context.Context, limit, offset int64) ([]*
 		ARRAY_AGG(DISTINCT pt.tag_name) FILTER (WHERE pt.tag_name IS NOT NULL) as tags
     FROM posts p
     LEFT JOIN users u ON u.id = p.user_id
-    LEFT JOIN comments c ON c.post_id = p.id
+    LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL
     LEFT JOIN post_likes pl ON pl.post_id = p.id
     LEFT JOIN post_tags pt ON pt.post_id = p.id
     LEFT JOIN post_files pf ON pf.post_id = p.id
+    WHERE p.hidden_at IS NULL AND p.deleted_at IS NULL
     GROUP BY p.id, p.content, p.user_id, u.name, p.created_at, p.updated_at
     ORDER BY like_count DESC, p.created_at DESC
     LIMIT $1 OFFSET $2`
@@ -288,6 +478,8 @@ func (s *PostStore) GetPublicFeed(ctx context.Context, limit, offset int64) ([]*
 			&postWithMetadata.Post.Username,
 			&postWithMetadata.Post.CreatedAt,
 			&postWithMetadata.Post.UpdatedAt,
+			&postWithMetadata.Post.Edited,
+			&postWithMetadata.Post.EditedAt,
 			&postWithMetadata.Post.Likes,
 			&postWithMetadata.CommentCount,
 			&postWithMetadata.Post.FileIDs,
@@ -305,7 +497,7 @@ func (s *PostStore) GetPublicFeed(ctx context.Context, limit, offset int64) ([]*
 
 func (s *PostStore) GetByTag(ctx context.Context, tagName string, limit, offset int) ([]*Post, error) {
 	query := `
-	SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, COUNT(pl.post_id), u.name,
+	SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, p.edited_at IS NOT NULL, p.edited_at, COUNT(pl.post_id), u.name,
 	ARRAY_AGG(pf.file_id) FILTER (WHERE pf.file_id IS NOT NULL) as file_ids,
 	ARRAY_AGG(pf.file_extension) FILTER (WHERE pf.file_extension IS NOT NULL) as file_extensions,
 	ARRAY_AGG(pf.original_filename) FILTER (WHERE pf.original_filename IS NOT NULL) as original_filenames,
@@ -315,7 +507,7 @@ func (s *PostStore) GetByTag(ctx context.Context, tagName string, limit, offset
 	LEFT JOIN post_files pf ON pf.post_id = p.id
 	LEFT JOIN post_likes pl ON pl.post_id = p.id
 	LEFT JOIN post_tags pt ON pt.post_id = p.id
-	WHERE pt.tag_name = $1
+	WHERE pt.tag_name = $1 AND p.hidden_at IS NULL AND p.deleted_at IS NULL
 	GROUP BY p.id, u.name
 	LIMIT $2 OFFSET $3`
 
@@ -335,6 +527,8 @@ func (s *PostStore) GetByTag(ctx context.Context, tagName string, limit, offset
 			&post.UserID,
 			&post.CreatedAt,
 			&post.UpdatedAt,
+			&post.Edited,
+			&post.EditedAt,
 			&post.Likes,
 			&post.Username,
 			&post.FileIDs,
@@ -349,3 +543,59 @@ func (s *PostStore) GetByTag(ctx context.Context, tagName string, limit, offset
 
 	return posts, nil
 }
+
+func (s *PostStore) Search(ctx context.Context, q string, limit, offset int64) (int64, []*PostSearchResult, error) {
+	var total int64
+	query := `
+	SELECT COUNT(*)
+	FROM posts p
+	WHERE p.search_vector @@ websearch_to_tsquery('english', $1) AND p.hidden_at IS NULL AND p.deleted_at IS NULL`
+	if err := s.db.QueryRow(ctx, query, q).Scan(&total); err != nil {
+		return -1, nil, err
+	}
+
+	query = `
+	SELECT p.id, p.title, p.content, p.user_id, u.name, p.created_at, p.updated_at,
+	p.edited_at IS NOT NULL, p.edited_at,
+	ts_rank(p.search_vector, q) AS rank,
+	ts_headline('english', html_escape(p.content), q, $4) AS snippet
+	FROM posts p
+	CROSS JOIN websearch_to_tsquery('english', $1) q
+	LEFT JOIN users u ON u.id = p.user_id
+	WHERE p.search_vector @@ q AND p.hidden_at IS NULL AND p.deleted_at IS NULL
+	ORDER BY rank DESC, p.created_at DESC
+	LIMIT $2 OFFSET $3`
+
+	rows, err := s.db.Query(ctx, query, q, limit, offset, headlineOptions)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer rows.Close()
+
+	var results []*PostSearchResult
+
+	for rows.Next() {
+		var result PostSearchResult
+		if err := rows.Scan(
+			&result.Post.ID,
+			&result.Post.Title,
+			&result.Post.Content,
+			&result.Post.UserID,
+			&result.Post.Username,
+			&result.Post.CreatedAt,
+			&result.Post.UpdatedAt,
+			&result.Post.Edited,
+			&result.Post.EditedAt,
+			&result.Rank,
+			&result.Snippet,
+		); err != nil {
+			return -1, nil, err
+		}
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	return total, results, nil
+}
@@ -0,0 +1,234 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+
+	ReportOpen      = "open"
+	ReportAssigned  = "assigned"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+
+	// Resolutions say what happened to the target.
+	ReportActionNone   = "none"
+	ReportActionHide   = "hide"
+	ReportActionDelete = "delete"
+)
+
+type Report struct {
+	ID         int64      `json:"id"`
+	ReporterID *int64     `json:"reporter_id"`
+	TargetType string     `json:"target_type"`
+	TargetID   int64      `json:"target_id"`
+	PostID     int64      `json:"post_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	AssigneeID *int64     `json:"assignee_id"`
+	Resolution *string    `json:"resolution"`
+	ResolverID *int64     `json:"resolver_id"`
+	Note       string     `json:"note"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ClosedAt   *time.Time `json:"closed_at"`
+}
+
+type ReportStore struct {
+	db DBTX
+}
+
+const reportColumns = `
+	id, reporter_id, target_type, target_id, post_id, reason, details, status,
+	assignee_id, resolution, resolver_id, note, created_at, updated_at, closed_at`
+
+func scanReport(row pgx.Row, report *Report) error {
+	return row.Scan(
+		&report.ID,
+		&report.ReporterID,
+		&report.TargetType,
+		&report.TargetID,
+		&report.PostID,
+		&report.Reason,
+		&report.Details,
+		&report.Status,
+		&report.AssigneeID,
+		&report.Resolution,
+		&report.ResolverID,
+		&report.Note,
+		&report.CreatedAt,
+		&report.UpdatedAt,
+		&report.ClosedAt,
+	)
+}
+
+func (s *ReportStore) Create(ctx context.Context, report *Report) error {
+	query := `
+	INSERT INTO reports (reporter_id, target_type, target_id, post_id, reason, details)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING` + reportColumns
+
+	return scanReport(s.db.QueryRow(ctx, query,
+		report.ReporterID,
+		report.TargetType,
+		report.TargetID,
+		report.PostID,
+		report.Reason,
+		report.Details,
+	), report)
+}
+
+func (s *ReportStore) GetByID(ctx context.Context, id int64) (*Report, error) {
+	var report Report
+	query := `SELECT` + reportColumns + `
+	FROM reports
+	WHERE id = $1`
+
+	if err := scanReport(s.db.QueryRow(ctx, query, id), &report); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// List returns the queue oldest first so nothing waits forever. Empty
+// filters match everything.
+func (s *ReportStore) List(ctx context.Context, status, targetType string, assigneeID *int64, limit, offset int64) (int64, []*Report, error) {
+	const where = `
+	WHERE ($1::text = '' OR status = $1)
+	AND ($2::text = '' OR target_type = $2)
+	AND ($3::bigint IS NULL OR assignee_id = $3)`
+
+	var total int64
+	query := `SELECT COUNT(*) FROM reports` + where
+	if err := s.db.QueryRow(ctx, query, status, targetType, assigneeID).Scan(&total); err != nil {
+		return -1, nil, err
+	}
+
+	query = `SELECT` + reportColumns + `
+	FROM reports` + where + `
+	ORDER BY created_at ASC, id ASC
+	LIMIT $4 OFFSET $5`
+
+	rows, err := s.db.Query(ctx, query, status, targetType, assigneeID, limit, offset)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+
+	for rows.Next() {
+		var report Report
+		if err := scanReport(rows, &report); err != nil {
+			return -1, nil, err
+		}
+		reports = append(reports, &report)
+	}
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	return total, reports, nil
+}
+
+// Assign hands a pending report to a moderator. It returns ErrConflict if
+// the report is already closed.
+func (s *ReportStore) Assign(ctx context.Context, id, assigneeID int64) (*Report, error) {
+	var report Report
+	query := `
+	UPDATE reports
+	SET status = $1, assignee_id = $2
+	WHERE id = $3 AND status IN ($4, $1)
+	RETURNING` + reportColumns
+
+	err := scanReport(s.db.QueryRow(ctx, query, ReportAssigned, assigneeID, id, ReportOpen), &report)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrConflict
+		default:
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// Resolve closes every pending report on the same target as report, since
+// acting on the target answers all of them. It returns ErrConflict if report
+// is already closed.
+func (s *ReportStore) Resolve(ctx context.Context, report *Report, resolverID int64, resolution, note string) error {
+	query := `
+	UPDATE reports
+	SET status = $1, resolution = $2, resolver_id = $3, note = $4, closed_at = NOW()
+	WHERE target_type = $5 AND target_id = $6 AND status IN ($7, $8)
+	RETURNING id`
+
+	rows, err := s.db.Query(ctx, query,
+		ReportResolved,
+		resolution,
+		resolverID,
+		note,
+		report.TargetType,
+		report.TargetID,
+		ReportOpen,
+		ReportAssigned,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	closed := false
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		closed = closed || id == report.ID
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !closed {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Dismiss closes the report without touching its target.
+func (s *ReportStore) Dismiss(ctx context.Context, id, resolverID int64, note string) (*Report, error) {
+	var report Report
+	query := `
+	UPDATE reports
+	SET status = $1, resolution = $2, resolver_id = $3, note = $4, closed_at = NOW()
+	WHERE id = $5 AND status IN ($6, $7)
+	RETURNING` + reportColumns
+
+	err := scanReport(s.db.QueryRow(ctx, query, ReportDismissed, ReportActionNone, resolverID, note, id, ReportOpen, ReportAssigned), &report)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrConflict
+		default:
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
@@ -6,34 +6,50 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrSystemRole        = errors.New("built-in roles can't be deleted")
+	ErrRoleInUse         = errors.New("role is still assigned to users")
 )
 
 type RoleStore struct {
-	db *pgxpool.Pool
+	db DBTX
 }
 
 type Role struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Level       int       `json:"level"`
-	Description string    `json:"description"`
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	RequireMFA  bool   `json:"require_mfa"`
+	// System and Permissions are only loaded by the role queries, not with
+	// a user.
+	System      bool      `json:"system"`
+	Permissions []string  `json:"permissions,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-func (s *RoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
-	var role Role
-	query := `
-	SELECT id, name, level, description, created_at
-	FROM roles
-	WHERE name = $1`
+const roleColumns = `
+	r.id, r.name, COALESCE(r.description, ''), r.require_mfa, r.system, r.created_at,
+	COALESCE(
+		(SELECT array_agg(p.name ORDER BY p.name)
+		FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE rp.role_id = r.id),
+		'{}'
+	)`
 
-	if err := s.db.QueryRow(ctx, query, name).Scan(
+func scanRole(row pgx.Row) (*Role, error) {
+	var role Role
+	if err := row.Scan(
 		&role.ID,
 		&role.Name,
-		&role.Level,
 		&role.Description,
+		&role.RequireMFA,
+		&role.System,
 		&role.CreatedAt,
+		&role.Permissions,
 	); err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -45,3 +61,152 @@ func (s *RoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
 
 	return &role, nil
 }
+
+func (s *RoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
+	query := `SELECT` + roleColumns + `
+	FROM roles r
+	WHERE r.name = $1`
+
+	return scanRole(s.db.QueryRow(ctx, query, name))
+}
+
+func (s *RoleStore) List(ctx context.Context) ([]*Role, error) {
+	query := `SELECT` + roleColumns + `
+	FROM roles r
+	ORDER BY r.system DESC, r.name`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (s *RoleStore) Create(ctx context.Context, role *Role) error {
+	query := `
+	INSERT INTO roles (name, description)
+	VALUES ($1, $2)
+	RETURNING id, require_mfa, system, created_at`
+
+	return s.db.QueryRow(ctx, query, role.Name, role.Description).Scan(
+		&role.ID,
+		&role.RequireMFA,
+		&role.System,
+		&role.CreatedAt,
+	)
+}
+
+// SetPermissions replaces the role's permissions. It returns
+// ErrUnknownPermission if any name isn't a permission, so it should run in a
+// transaction.
+func (s *RoleStore) SetPermissions(ctx context.Context, roleID int64, names []string) error {
+	if _, err := s.db.Exec(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO role_permissions (role_id, permission_id)
+	SELECT $1, id
+	FROM permissions
+	WHERE name = ANY($2)`
+
+	result, err := s.db.Exec(ctx, query, roleID, names)
+	if err != nil {
+		return err
+	}
+
+	unique := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		unique[name] = struct{}{}
+	}
+
+	if result.RowsAffected() != int64(len(unique)) {
+		return ErrUnknownPermission
+	}
+
+	return nil
+}
+
+func (s *RoleStore) HasPermission(ctx context.Context, roleID int64, permission string) (bool, error) {
+	var allowed bool
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE rp.role_id = $1 AND p.name = $2
+	)`
+
+	err := s.db.QueryRow(ctx, query, roleID, permission).Scan(&allowed)
+	return allowed, err
+}
+
+// Covers reports whether roleID has every permission otherID has.
+func (s *RoleStore) Covers(ctx context.Context, roleID, otherID int64) (bool, error) {
+	var covers bool
+	query := `
+	SELECT NOT EXISTS (
+		SELECT 1
+		FROM role_permissions other
+		WHERE other.role_id = $2
+		AND other.permission_id NOT IN (
+			SELECT permission_id FROM role_permissions WHERE role_id = $1
+		)
+	)`
+
+	err := s.db.QueryRow(ctx, query, roleID, otherID).Scan(&covers)
+	return covers, err
+}
+
+func (s *RoleStore) SetRequireMFA(ctx context.Context, name string, required bool) (*Role, error) {
+	query := `
+	WITH r AS (
+		UPDATE roles
+		SET require_mfa = $1
+		WHERE name = $2
+		RETURNING *
+	)
+	SELECT` + roleColumns + `
+	FROM r`
+
+	return scanRole(s.db.QueryRow(ctx, query, required, name))
+}
+
+// Delete removes a custom role. Deleting a role would cascade to its users,
+// so roles still in use are refused with ErrRoleInUse.
+func (s *RoleStore) Delete(ctx context.Context, name string) error {
+	role, err := s.GetByName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if role.System {
+		return ErrSystemRole
+	}
+
+	query := `
+	DELETE FROM roles
+	WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM users WHERE role_id = $1)`
+
+	result, err := s.db.Exec(ctx, query, role.ID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRoleInUse
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package store
+
+// Options passed to ts_headline when building highlighted search snippets.
+// The text going in has to be run through html_escape first, so that the
+// <mark> tags are the only markup in a snippet.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+type PostSearchResult struct {
+	Post    Post    `json:"post"`
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type UserSearchResult struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	DisplayName string  `json:"display_name"`
+	Rank        float32 `json:"rank"`
+	Snippet     string  `json:"snippet"`
+}
+
+type TagSearchResult struct {
+	Tag       Tag     `json:"tag"`
+	PostCount int64   `json:"post_count"`
+	Rank      float32 `json:"rank"`
+	Snippet   string  `json:"snippet"`
+}
@@ -23,11 +23,19 @@ type Storage struct {
 		Create(ctx context.Context, title, content string, userID int64) (*Post, error)
 		GetByID(ctx context.Context, id int64) (*Post, error)
 		GetByUserID(ctx context.Context, userID int64) ([]*Post, error)
-		Update(ctx context.Context, content string, id int64) (*Post, error)
-		Delete(ctx context.Context, id int64) error
+		Update(ctx context.Context, title, content string, id int64) (*Post, error)
+		Delete(ctx context.Context, id, deletedBy int64) error
+		Hide(ctx context.Context, id int64) error
+		Unhide(ctx context.Context, id int64) error
+		GetDeleted(ctx context.Context, id int64) (*Post, error)
+		Restore(ctx context.Context, id int64) error
+		ListDeleted(ctx context.Context, userID int64) ([]*Post, error)
+		ListDeletedBefore(ctx context.Context, before time.Time, limit int64) ([]int64, error)
+		Purge(ctx context.Context, id int64) error
 		GetUserFeed(ctx context.Context, userID, limit, offset int64) ([]*PostWithMetadata, error)
 		GetPublicFeed(ctx context.Context, limit, offset int64) ([]*PostWithMetadata, error)
 		GetByTag(ctx context.Context, tagName string, limit, offset int) ([]*Post, error)
+		Search(ctx context.Context, q string, limit, offset int64) (int64, []*PostSearchResult, error)
 	}
 	Users interface {
 		Create(ctx context.Context, user *User) error
@@ -35,13 +43,28 @@ type Storage struct {
 		GetByName(ctx context.Context, name string) (*User, error)
 		GetByID(ctx context.Context, id int64) (*User, error)
 		GetByToken(tokenScope, tokenPlaintext string) (*User, error)
-		UpdateRole(ctx context.Context, name string, role *Role) (*User, error)
+		UpdateRole(ctx context.Context, userID int64, role *Role) (*User, error)
 		GetIDs(ctx context.Context, limit, offset int64) ([]int, error)
 		Update(user *User) error
+		UpdateEmail(ctx context.Context, userID int64, email string) error
+		ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error
+		CancelDeletion(ctx context.Context, userID int64) error
+		ListDueForDeletion(ctx context.Context, limit int64) ([]int64, error)
+		Delete(ctx context.Context, userID int64) error
+		Search(ctx context.Context, q string, limit, offset int64) (int64, []*UserSearchResult, error)
+		List(ctx context.Context, filter UserFilter, limit, offset int64) (int64, []*User, error)
+		CountWithPermission(ctx context.Context, permission string) (int64, error)
+	}
+	PostRevisions interface {
+		Create(ctx context.Context, revision *PostRevision) error
+		List(ctx context.Context, postID int64) ([]*PostRevision, error)
+		Get(ctx context.Context, postID, revision int64) (*PostRevision, error)
+		Redact(ctx context.Context, postID, revision, redactedBy int64) error
 	}
 	PostFiles interface {
 		Create(ctx context.Context, fileID uuid.UUID, fileExtension, originalFilename string, postID int64) (*PostFile, error)
 		GetByPostID(ctx context.Context, postID int64) ([]*PostFile, error)
+		ListByUser(ctx context.Context, userID int64) ([]*PostFile, error)
 		// Update(ctx context.Context, tx pgx.Tx, fileID uuid.UUID, fileExtension, originalFilename string, postID int64) (*PostFile, error)
 		Delete(ctx context.Context, fileID uuid.UUID) error
 	}
@@ -50,6 +73,8 @@ type Storage struct {
 		GetByID(ctx context.Context, id int64) (*Tag, error)
 		GetByName(ctx context.Context, name string) (*Tag, error)
 		Delete(ctx context.Context, id int64) error
+		Search(ctx context.Context, q string, limit, offset int64) (int64, []*TagSearchResult, error)
+		ListByUser(ctx context.Context, userID int64) ([]*Tag, error)
 	}
 	PostTags interface {
 		Create(ctx context.Context, postID int64, tagName string) (*PostTag, error)
@@ -58,13 +83,30 @@ type Storage struct {
 	}
 	Roles interface {
 		GetByName(ctx context.Context, name string) (*Role, error)
+		List(ctx context.Context) ([]*Role, error)
+		Create(ctx context.Context, role *Role) error
+		SetPermissions(ctx context.Context, roleID int64, names []string) error
+		HasPermission(ctx context.Context, roleID int64, permission string) (bool, error)
+		Covers(ctx context.Context, roleID, otherID int64) (bool, error)
+		SetRequireMFA(ctx context.Context, name string, required bool) (*Role, error)
+		Delete(ctx context.Context, name string) error
+	}
+	Permissions interface {
+		List(ctx context.Context) ([]*Permission, error)
 	}
 	Comments interface {
-		Create(ctx context.Context, content string, userID, postID int64) (*Comment, error)
+		Create(ctx context.Context, content string, userID, postID int64, parentCommentID *int64) (*Comment, error)
 		GetByID(ctx context.Context, commentID int64) (*Comment, error)
 		Update(ctx context.Context, content string, commentID int64) (*Comment, error)
-		Delete(ctx context.Context, commentID int64) error
-		List(ctx context.Context, postID int64, sortBy string, limit, offset int64) (int64, []*Comment, error)
+		Delete(ctx context.Context, commentID, deletedBy int64) error
+		Hide(ctx context.Context, commentID int64) error
+		Unhide(ctx context.Context, commentID int64) error
+		GetDeleted(ctx context.Context, commentID int64) (*Comment, error)
+		Restore(ctx context.Context, commentID int64) error
+		ListDeleted(ctx context.Context, userID int64) ([]*Comment, error)
+		PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error)
+		List(ctx context.Context, postID int64, sortBy string, depth, limit, offset int64) (int64, []*Comment, error)
+		ListByUser(ctx context.Context, userID int64) ([]*Comment, error)
 	}
 	// UserLimits interface {
 	// 	Create(ctx context.Context, userID int64) (*UserLimit, error)
@@ -75,26 +117,103 @@ type Storage struct {
 	PostLikes interface {
 		Create(ctx context.Context, userID, postID int64) (*PostLike, error)
 		Delete(ctx context.Context, userID, postID int64) error
+		ListByUser(ctx context.Context, userID int64) ([]*PostLike, error)
+	}
+	CommentLikes interface {
+		Create(ctx context.Context, userID, commentID int64) (*CommentLike, error)
+		Delete(ctx context.Context, userID, commentID int64) error
+		ListByUser(ctx context.Context, userID int64) ([]*CommentLike, error)
+	}
+	Followers interface {
+		Follow(ctx context.Context, followerID, userID int64) (*Follower, error)
+		Unfollow(ctx context.Context, followerID, userID int64) error
+	}
+	MFA interface {
+		CreateTOTP(ctx context.Context, userID int64, secret string) (*TOTP, error)
+		GetTOTP(ctx context.Context, userID int64) (*TOTP, error)
+		ConfirmTOTP(ctx context.Context, userID int64) error
+		UseStep(ctx context.Context, userID, step int64) error
+		DeleteTOTP(ctx context.Context, userID int64) error
+		ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte) error
+		UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error
+	}
+	Identities interface {
+		Create(ctx context.Context, identity *Identity) error
+		GetBySubject(ctx context.Context, provider, subject string) (*Identity, error)
+		ListByUser(ctx context.Context, userID int64) ([]*Identity, error)
+		DeleteByUser(ctx context.Context, userID int64) error
+	}
+	AccessTokens interface {
+		Create(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time) (*AccessToken, error)
+		GetByPlaintext(ctx context.Context, plaintext string) (*AccessToken, error)
+		List(ctx context.Context, userID int64) ([]*AccessToken, error)
+		Delete(ctx context.Context, id, userID int64) error
+		DeleteByUser(ctx context.Context, userID int64) error
+	}
+	EmailChanges interface {
+		Create(ctx context.Context, userID int64, newEmail string) (*EmailChange, error)
+		Take(ctx context.Context, userID int64) (*EmailChange, error)
+	}
+	Exports interface {
+		Create(ctx context.Context, userID int64, expiresAt time.Time) (*Export, error)
+		GetByID(ctx context.Context, id uuid.UUID, userID int64) (*Export, error)
+		GetLatest(ctx context.Context, userID int64) (*Export, error)
+		MarkReady(ctx context.Context, id uuid.UUID, objectKey string) error
+		MarkFailed(ctx context.Context, id uuid.UUID) error
+		ListExpired(ctx context.Context, limit int64) ([]*Export, error)
+		ListByUser(ctx context.Context, userID int64) ([]*Export, error)
+		Delete(ctx context.Context, id uuid.UUID) error
+	}
+	Suspensions interface {
+		Create(ctx context.Context, suspension *Suspension) error
+		GetActive(ctx context.Context, userID int64) (*Suspension, error)
+		Lift(ctx context.Context, userID, liftedBy int64) error
+	}
+	Reports interface {
+		Create(ctx context.Context, report *Report) error
+		GetByID(ctx context.Context, id int64) (*Report, error)
+		List(ctx context.Context, status, targetType string, assigneeID *int64, limit, offset int64) (int64, []*Report, error)
+		Assign(ctx context.Context, id, assigneeID int64) (*Report, error)
+		Resolve(ctx context.Context, report *Report, resolverID int64, resolution, note string) error
+		Dismiss(ctx context.Context, id, resolverID int64, note string) (*Report, error)
+	}
+	AuditLog interface {
+		Create(ctx context.Context, event *AuditEvent) error
+		List(ctx context.Context, filter AuditFilter, limit, offset int64) (int64, []*AuditEvent, error)
 	}
 	Tokens interface {
 		New(userID int64, ttl time.Duration, scope string) (*Token, error)
 		Delete(scope string, userID int64) error
+		DeleteByUser(userID int64) error
+		Consume(scope, plaintext string) (int64, error)
 	}
 }
 
 func NewStorage(db *pgxpool.Pool) Storage {
 	return Storage{
-		db:        db,
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		PostFiles: &PostFileStore{db},
-		Tags:      &TagStore{db},
-		PostTags:  &PostTagStore{db},
-		Roles:     &RoleStore{db},
-		Comments:  &CommentStore{db},
+		db:            db,
+		Posts:         &PostStore{db},
+		Users:         &UserStore{db},
+		PostFiles:     &PostFileStore{db},
+		PostRevisions: &PostRevisionStore{db},
+		Tags:          &TagStore{db},
+		PostTags:      &PostTagStore{db},
+		Roles:         &RoleStore{db},
+		Comments:      &CommentStore{db},
 		// UserLimits: &UserLimitStore{db},
-		PostLikes: &PostLikeStore{db},
-		Tokens:    &TokenStore{db},
+		PostLikes:    &PostLikeStore{db},
+		CommentLikes: &CommentLikeStore{db},
+		Permissions:  &PermissionStore{db},
+		Followers:    &FollowerStore{db},
+		MFA:          &MFAStore{db},
+		Identities:   &IdentityStore{db},
+		AccessTokens: &AccessTokenStore{db},
+		EmailChanges: &EmailChangeStore{db},
+		Exports:      &ExportStore{db},
+		Suspensions:  &SuspensionStore{db},
+		Reports:      &ReportStore{db},
+		AuditLog:     &AuditLogStore{db},
+		Tokens:       &TokenStore{db},
 	}
 }
 
@@ -112,16 +231,28 @@ func (s *Storage) WithTx(ctx context.Context, fn func(*Storage) error) error {
 	defer tx.Rollback(ctx)
 
 	txStorage := &Storage{
-		db:        s.db,
-		Users:     &UserStore{db: tx},
-		Posts:     &PostStore{db: tx},
-		PostFiles: &PostFileStore{db: tx},
+		db:            s.db,
+		Users:         &UserStore{db: tx},
+		Posts:         &PostStore{db: tx},
+		PostFiles:     &PostFileStore{db: tx},
+		PostRevisions: &PostRevisionStore{db: tx},
 		// UserLimits: &UserLimitStore{db: tx},
-		Tags:      &TagStore{db: tx},
-		PostTags:  &PostTagStore{db: tx},
-		Comments:  &CommentStore{db: tx},
-		PostLikes: &PostLikeStore{db: tx},
-		// Followers:    &FollowerStore{db: tx},
+		Tags:         &TagStore{db: tx},
+		PostTags:     &PostTagStore{db: tx},
+		Roles:        &RoleStore{db: tx},
+		Permissions:  &PermissionStore{db: tx},
+		Comments:     &CommentStore{db: tx},
+		PostLikes:    &PostLikeStore{db: tx},
+		CommentLikes: &CommentLikeStore{db: tx},
+		Followers:    &FollowerStore{db: tx},
+		MFA:          &MFAStore{db: tx},
+		Identities:   &IdentityStore{db: tx},
+		AccessTokens: &AccessTokenStore{db: tx},
+		EmailChanges: &EmailChangeStore{db: tx},
+		Exports:      &ExportStore{db: tx},
+		Suspensions:  &SuspensionStore{db: tx},
+		Reports:      &ReportStore{db: tx},
+		AuditLog:     &AuditLogStore{db: tx},
 		// UserProfiles: &UserProfileStore{db: tx},
 		Tokens: &TokenStore{db: tx},
 	}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Suspension keeps a user from signing in until ExpiresAt. A suspension
+// without an expiry is a permanent ban.
+type Suspension struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	ModeratorID *int64     `json:"moderator_id"`
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (s *Suspension) Permanent() bool {
+	return s.ExpiresAt == nil
+}
+
+type SuspensionStore struct {
+	db DBTX
+}
+
+// Create replaces any active suspension of the user with s.
+func (s *SuspensionStore) Create(ctx context.Context, suspension *Suspension) error {
+	lift := `
+	UPDATE user_suspensions
+	SET lifted_at = NOW(), lifted_by = $1
+	WHERE user_id = $2 AND lifted_at IS NULL`
+
+	if _, err := s.db.Exec(ctx, lift, suspension.ModeratorID, suspension.UserID); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO user_suspensions (user_id, moderator_id, reason, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+
+	return s.db.QueryRow(ctx, query,
+		suspension.UserID,
+		suspension.ModeratorID,
+		suspension.Reason,
+		suspension.ExpiresAt,
+	).Scan(&suspension.ID, &suspension.CreatedAt)
+}
+
+func (s *SuspensionStore) GetActive(ctx context.Context, userID int64) (*Suspension, error) {
+	var suspension Suspension
+	query := `
+	SELECT id, user_id, moderator_id, reason, expires_at, created_at
+	FROM user_suspensions
+	WHERE user_id = $1 AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	ORDER BY created_at DESC
+	LIMIT 1`
+
+	err := s.db.QueryRow(ctx, query, userID).Scan(
+		&suspension.ID,
+		&suspension.UserID,
+		&suspension.ModeratorID,
+		&suspension.Reason,
+		&suspension.ExpiresAt,
+		&suspension.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &suspension, nil
+}
+
+// Lift ends the user's active suspension or ban. It returns ErrNotFound if
+// there is none.
+func (s *SuspensionStore) Lift(ctx context.Context, userID, liftedBy int64) error {
+	query := `
+	UPDATE user_suspensions
+	SET lifted_at = NOW(), lifted_by = $1
+	WHERE user_id = $2 AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+
+	result, err := s.db.Exec(ctx, query, liftedBy, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -98,3 +98,82 @@ func (s *TagStore) Delete(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+func (s *TagStore) Search(ctx context.Context, q string, limit, offset int64) (int64, []*TagSearchResult, error) {
+	var total int64
+	query := `
+	SELECT COUNT(*)
+	FROM tags t
+	WHERE t.search_vector @@ websearch_to_tsquery('simple', $1)`
+	if err := s.db.QueryRow(ctx, query, q).Scan(&total); err != nil {
+		return -1, nil, err
+	}
+
+	query = `
+	SELECT t.id, t.name, t.created_at,
+	(SELECT COUNT(*) FROM post_tags pt JOIN posts p ON p.id = pt.post_id
+	 WHERE pt.tag_id = t.id AND p.deleted_at IS NULL) AS post_count,
+	ts_rank(t.search_vector, q) AS rank,
+	ts_headline('simple', html_escape(t.name), q, $4) AS snippet
+	FROM tags t
+	CROSS JOIN websearch_to_tsquery('simple', $1) q
+	WHERE t.search_vector @@ q
+	ORDER BY rank DESC, post_count DESC
+	LIMIT $2 OFFSET $3`
+
+	rows, err := s.db.Query(ctx, query, q, limit, offset, headlineOptions)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer rows.Close()
+
+	var results []*TagSearchResult
+
+	for rows.Next() {
+		var result TagSearchResult
+		if err := rows.Scan(
+			&result.Tag.ID,
+			&result.Tag.Name,
+			&result.Tag.CreatedAt,
+			&result.PostCount,
+			&result.Rank,
+			&result.Snippet,
+		); err != nil {
+			return -1, nil, err
+		}
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	return total, results, nil
+}
+
+// ListByUser returns the tags on the user's posts.
+func (s *TagStore) ListByUser(ctx context.Context, userID int64) ([]*Tag, error) {
+	query := `
+	SELECT DISTINCT t.id, t.name, t.created_at
+	FROM tags t
+	JOIN post_tags pt ON pt.tag_id = t.id
+	JOIN posts p ON p.id = pt.post_id
+	WHERE p.user_id = $1 AND p.deleted_at IS NULL
+	ORDER BY t.name`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	return tags, rows.Err()
+}
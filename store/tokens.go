@@ -5,11 +5,17 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 const (
-	ScopeActivation = "activation"
+	ScopeActivation    = "activation"
+	ScopePasswordReset = "password_reset"
+	ScopeLogin         = "login"
+	ScopeEmailChange   = "email_change"
 )
 
 type Token struct {
@@ -78,3 +84,44 @@ func (s *TokenStore) Delete(scope string, userID int64) error {
 	_, err := s.db.Exec(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteByUser removes every outstanding token of the user, whatever its
+// scope.
+func (s *TokenStore) DeleteByUser(userID int64) error {
+	query := `
+		DELETE from user_tokens
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx, query, userID)
+	return err
+}
+
+// Consume deletes an unexpired token and returns the user it belonged to, so
+// that of two concurrent requests with the same token only one succeeds.
+func (s *TokenStore) Consume(scope, plaintext string) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+		DELETE FROM user_tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > $3
+		RETURNING user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRow(ctx, query, tokenHash[:], scope, time.Now()).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
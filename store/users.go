@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -17,9 +18,15 @@ type User struct {
 	Email       string    `json:"email"`
 	Password    password  `json:"-"`
 	Activated   bool      `json:"activated"`
+	MFAEnabled  bool      `json:"mfa_enabled"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Role        Role      `json:"role"`
+	// Suspension is only loaded by List.
+	Suspension *Suspension `json:"suspension,omitempty"`
+	// DeletionScheduledAt is only loaded by GetByID, which is how requests
+	// are authenticated.
+	DeletionScheduledAt *time.Time `json:"-"`
 }
 
 type password struct {
@@ -49,8 +56,8 @@ type UserStore struct {
 
 func (s *UserStore) Create(ctx context.Context, user *User) error {
 	query := `
-	INSERT INTO users (name, display_name, email, password_hash, role_id, role_name)
-	VALUES ($1, $2, $3, $4, $5, $6)
+	INSERT INTO users (name, display_name, email, password_hash, role_id, role_name, activated)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
 	RETURNING id, name, display_name, email, activated, created_at, updated_at
 	`
 
@@ -62,6 +69,7 @@ func (s *UserStore) Create(ctx context.Context, user *User) error {
 		user.Password.hash,
 		user.Role.ID,
 		user.Role.Name,
+		user.Activated,
 	).Scan(
 		&user.ID,
 		&user.Name,
@@ -82,8 +90,8 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	var user User
 
 	query := `
-		SELECT users.id, users.name, display_name, email, password_hash, activated, users.created_at, users.updated_at,
-		       roles.id, roles.name, roles.level, roles.description, roles.created_at
+		SELECT users.id, users.name, display_name, email, password_hash, activated, mfa_enabled, users.created_at, users.updated_at,
+		       roles.id, roles.name, roles.description, roles.created_at, roles.require_mfa
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE email = $1`
@@ -95,16 +103,22 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.Role.ID,
 		&user.Role.Name,
-		&user.Role.Level,
 		&user.Role.Description,
 		&user.Role.CreatedAt,
+		&user.Role.RequireMFA,
 	)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &user, nil
@@ -114,8 +128,8 @@ func (s *UserStore) GetByName(ctx context.Context, name string) (*User, error) {
 	var user User
 
 	query := `
-		SELECT users.id, users.name, display_name, email, password_hash, activated, users.created_at, users.updated_at,
-		       roles.id, roles.name, roles.level, roles.description, roles.created_at
+		SELECT users.id, users.name, display_name, email, password_hash, activated, mfa_enabled, users.created_at, users.updated_at,
+		       roles.id, roles.name, roles.description, roles.created_at, roles.require_mfa
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.name = $1`
@@ -127,16 +141,22 @@ func (s *UserStore) GetByName(ctx context.Context, name string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.Role.ID,
 		&user.Role.Name,
-		&user.Role.Level,
 		&user.Role.Description,
 		&user.Role.CreatedAt,
+		&user.Role.RequireMFA,
 	)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &user, nil
@@ -146,8 +166,9 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	var user User
 
 	query := `
-		SELECT users.id, users.name, display_name, email, password_hash, activated, users.created_at, users.updated_at,
-		       roles.id, roles.name, roles.level, roles.description, roles.created_at
+		SELECT users.id, users.name, display_name, email, password_hash, activated, mfa_enabled, users.created_at, users.updated_at,
+		       users.deletion_scheduled_at,
+		       roles.id, roles.name, roles.description, roles.created_at, roles.require_mfa
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1`
@@ -159,16 +180,23 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeletionScheduledAt,
 		&user.Role.ID,
 		&user.Role.Name,
-		&user.Role.Level,
 		&user.Role.Description,
 		&user.Role.CreatedAt,
+		&user.Role.RequireMFA,
 	)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &user, nil
@@ -178,7 +206,7 @@ func (s *UserStore) GetByToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-		SELECT u.id, u.name, u.display_name, u.email, u.password_hash, u.activated, u.created_at, u.updated_at
+		SELECT u.id, u.name, u.display_name, u.email, u.password_hash, u.activated, u.mfa_enabled, u.created_at, u.updated_at
 		FROM users u
 		INNER JOIN user_tokens t ON u.id = t.user_id
 		WHERE t.hash = $1
@@ -197,6 +225,7 @@ func (s *UserStore) GetByToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -212,13 +241,13 @@ func (s *UserStore) GetByToken(tokenScope, tokenPlaintext string) (*User, error)
 	return &user, nil
 }
 
-func (s *UserStore) UpdateRole(ctx context.Context, name string, role *Role) (*User, error) {
+func (s *UserStore) UpdateRole(ctx context.Context, userID int64, role *Role) (*User, error) {
 	var user User
 	query := `
 	WITH updated AS (
 		UPDATE users
 		SET role_id = $1, role_name = $2
-		WHERE name = $3
+		WHERE id = $3
 		RETURNING *
 	)
 	SELECT
@@ -228,28 +257,32 @@ func (s *UserStore) UpdateRole(ctx context.Context, name string, role *Role) (*U
 		updated.email,
 		updated.password_hash,
 		updated.activated,
+		updated.mfa_enabled,
 		updated.created_at,
 		updated.updated_at,
 		roles.id as "roles.id",
 		roles.name as "roles.name",
-		roles.level as "roles.level",
-		roles.description as "roles.description"
+		roles.description as "roles.description",
+		roles.created_at as "roles.created_at",
+		roles.require_mfa as "roles.require_mfa"
 	FROM updated
 	JOIN roles ON (updated.role_id = roles.id)`
 
-	err := s.db.QueryRow(ctx, query, role.ID, role.Name, name).Scan(
+	err := s.db.QueryRow(ctx, query, role.ID, role.Name, userID).Scan(
 		&user.ID,
 		&user.Name,
 		&user.DisplayName,
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.Role.ID,
 		&user.Role.Name,
-		&user.Role.Level,
 		&user.Role.Description,
+		&user.Role.CreatedAt,
+		&user.Role.RequireMFA,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -261,6 +294,129 @@ func (s *UserStore) UpdateRole(ctx context.Context, name string, role *Role) (*U
 	return &user, nil
 }
 
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+)
+
+// UserFilter narrows List. Zero values match everything.
+type UserFilter struct {
+	Role      string
+	Status    string
+	Activated *bool
+	// Query matches the start of the name or email.
+	Query string
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// List returns a page of users, newest first, with their active suspension.
+func (s *UserStore) List(ctx context.Context, filter UserFilter, limit, offset int64) (int64, []*User, error) {
+	const from = `
+	FROM users u
+	JOIN roles r ON (u.role_id = r.id)
+	LEFT JOIN LATERAL (
+		SELECT id, moderator_id, reason, expires_at, created_at
+		FROM user_suspensions
+		WHERE user_id = u.id AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at DESC
+		LIMIT 1
+	) s ON true
+	WHERE ($1::text = '' OR r.name = $1)
+	AND ($2::text = ''
+		OR ($2 = 'active' AND s.id IS NULL)
+		OR ($2 = 'suspended' AND s.id IS NOT NULL AND s.expires_at IS NOT NULL)
+		OR ($2 = 'banned' AND s.id IS NOT NULL AND s.expires_at IS NULL))
+	AND ($3::boolean IS NULL OR u.activated = $3)
+	AND ($4::text = '' OR u.name ILIKE $4 || '%' OR u.email ILIKE $4 || '%')`
+
+	var total int64
+	query := `SELECT COUNT(*)` + from
+	if err := s.db.QueryRow(ctx, query,
+		filter.Role,
+		filter.Status,
+		filter.Activated,
+		likeEscaper.Replace(filter.Query),
+	).Scan(&total); err != nil {
+		return -1, nil, err
+	}
+
+	query = `
+	SELECT u.id, u.name, u.display_name, u.email, u.activated, u.mfa_enabled, u.created_at, u.updated_at,
+	       r.id, r.name, r.description, r.created_at, r.require_mfa,
+	       s.id, s.moderator_id, s.reason, s.expires_at, s.created_at` + from + `
+	ORDER BY u.created_at DESC, u.id DESC
+	LIMIT $5 OFFSET $6`
+
+	rows, err := s.db.Query(ctx, query,
+		filter.Role,
+		filter.Status,
+		filter.Activated,
+		likeEscaper.Replace(filter.Query),
+		limit,
+		offset,
+	)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+		var (
+			suspensionID *int64
+			moderatorID  *int64
+			reason       *string
+			expiresAt    *time.Time
+			suspendedAt  *time.Time
+		)
+
+		if err := rows.Scan(
+			&user.ID,
+			&user.Name,
+			&user.DisplayName,
+			&user.Email,
+			&user.Activated,
+			&user.MFAEnabled,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Role.ID,
+			&user.Role.Name,
+			&user.Role.Description,
+			&user.Role.CreatedAt,
+			&user.Role.RequireMFA,
+			&suspensionID,
+			&moderatorID,
+			&reason,
+			&expiresAt,
+			&suspendedAt,
+		); err != nil {
+			return -1, nil, err
+		}
+
+		if suspensionID != nil {
+			user.Suspension = &Suspension{
+				ID:          *suspensionID,
+				UserID:      user.ID,
+				ModeratorID: moderatorID,
+				Reason:      *reason,
+				ExpiresAt:   expiresAt,
+				CreatedAt:   *suspendedAt,
+			}
+		}
+
+		users = append(users, &user)
+	}
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	return total, users, nil
+}
+
 func (s *UserStore) GetIDs(ctx context.Context, limit, offset int64) ([]int, error) {
 	var userIDs []int
 	query := `
@@ -306,3 +462,170 @@ func (s *UserStore) Update(user *User) error {
 	_, err := s.db.Exec(ctx, query, args...)
 	return err
 }
+
+func (s *UserStore) UpdateEmail(ctx context.Context, userID int64, email string) error {
+	query := `
+	UPDATE users
+	SET email = $1
+	WHERE id = $2`
+
+	result, err := s.db.Exec(ctx, query, email, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ScheduleDeletion marks the account for a hard delete at the given time. It
+// returns ErrConflict if a deletion is already scheduled.
+func (s *UserStore) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	query := `
+	UPDATE users
+	SET deletion_scheduled_at = $1
+	WHERE id = $2 AND deletion_scheduled_at IS NULL`
+
+	result, err := s.db.Exec(ctx, query, at, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// CancelDeletion returns ErrNotFound if no deletion was scheduled.
+func (s *UserStore) CancelDeletion(ctx context.Context, userID int64) error {
+	query := `
+	UPDATE users
+	SET deletion_scheduled_at = NULL
+	WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+
+	result, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) ListDueForDeletion(ctx context.Context, limit int64) ([]int64, error) {
+	query := `
+	SELECT id
+	FROM users
+	WHERE deletion_scheduled_at <= NOW()
+	ORDER BY deletion_scheduled_at
+	LIMIT $1`
+
+	rows, err := s.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// Delete removes the user; everything they own goes with them through ON
+// DELETE CASCADE.
+func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	query := `DELETE FROM users WHERE id = $1`
+
+	result, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) Search(ctx context.Context, q string, limit, offset int64) (int64, []*UserSearchResult, error) {
+	var total int64
+	query := `
+	SELECT COUNT(*)
+	FROM users u
+	WHERE u.search_vector @@ websearch_to_tsquery('simple', $1)`
+	if err := s.db.QueryRow(ctx, query, q).Scan(&total); err != nil {
+		return -1, nil, err
+	}
+
+	query = `
+	SELECT u.id, u.name, u.display_name,
+	ts_rank(u.search_vector, q) AS rank,
+	ts_headline('simple', html_escape(u.name || ' ' || u.display_name), q, $4) AS snippet
+	FROM users u
+	CROSS JOIN websearch_to_tsquery('simple', $1) q
+	WHERE u.search_vector @@ q
+	ORDER BY rank DESC, u.name ASC
+	LIMIT $2 OFFSET $3`
+
+	rows, err := s.db.Query(ctx, query, q, limit, offset, headlineOptions)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer rows.Close()
+
+	var results []*UserSearchResult
+
+	for rows.Next() {
+		var result UserSearchResult
+		if err := rows.Scan(
+			&result.ID,
+			&result.Name,
+			&result.DisplayName,
+			&result.Rank,
+			&result.Snippet,
+		); err != nil {
+			return -1, nil, err
+		}
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	return total, results, nil
+}
+
+// CountWithPermission counts the users whose role has permission. It locks
+// their rows, so two transactions that each take the permission away from
+// someone can't both see the other as still holding it.
+func (s *UserStore) CountWithPermission(ctx context.Context, permission string) (int64, error) {
+	var count int64
+	query := `
+	SELECT COUNT(*) FROM (
+		SELECT u.id
+		FROM users u
+		JOIN role_permissions rp ON rp.role_id = u.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE p.name = $1
+		FOR UPDATE OF u
+	) holders`
+
+	err := s.db.QueryRow(ctx, query, permission).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,170 @@
+package textdiff
+
+import "regexp"
+
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Chunk is a run of text that is the same in both versions, only in the new
+// one, or only in the old one.
+type Chunk struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+var tokenPattern = regexp.MustCompile(`\s+|[^\s]+`)
+
+// Words diffs a and b a word at a time, keeping whitespace, so that joining
+// the equal and delete chunks gives back a and joining the equal and insert
+// chunks gives back b.
+//
+// It uses Myers' algorithm in its linear space form: memory grows with the
+// number of words, and time with the number of words times the size of the
+// edit.
+func Words(a, b string) []Chunk {
+	d := differ{chunks: []Chunk{}}
+	d.diff(tokenPattern.FindAllString(a, -1), tokenPattern.FindAllString(b, -1))
+	return d.chunks
+}
+
+type differ struct {
+	chunks []Chunk
+}
+
+func (d *differ) add(op string, tokens []string) {
+	for _, token := range tokens {
+		if n := len(d.chunks); n > 0 && d.chunks[n-1].Op == op {
+			d.chunks[n-1].Text += token
+			continue
+		}
+		d.chunks = append(d.chunks, Chunk{Op: op, Text: token})
+	}
+}
+
+func (d *differ) diff(a, b []string) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	d.add(OpEqual, a[:prefix])
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	switch {
+	case len(middleA) == 0:
+		d.add(OpInsert, middleB)
+	case len(middleB) == 0:
+		d.add(OpDelete, middleA)
+	default:
+		x, y, ok := middleSnake(middleA, middleB)
+		if ok {
+			d.diff(middleA[:x], middleB[:y])
+			d.diff(middleA[x:], middleB[y:])
+		} else {
+			d.add(OpDelete, middleA)
+			d.add(OpInsert, middleB)
+		}
+	}
+
+	d.add(OpEqual, a[len(a)-suffix:])
+}
+
+// middleSnake walks shortest edit paths from both ends of a and b at once and
+// returns where they meet, which splits the problem in two. ok is false when
+// a and b have nothing in common.
+func middleSnake(a, b []string) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+
+	// forward[offset+k] is the furthest x reached on diagonal k = x - y going
+	// forwards from the start, backward[offset+k] the same going back from the
+	// end, counted from the end.
+	forward := make([]int, size)
+	backward := make([]int, size)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+	// With an odd delta the paths can only meet on a forward step.
+	front := delta%2 != 0
+
+	// Diagonals that ran off the edge of the grid are skipped from then on.
+	var kStartF, kEndF, kStartB, kEndB int
+
+	for d := 0; d < maxD; d++ {
+		for k := -d + kStartF; k <= d-kEndF; k += 2 {
+			i := offset + k
+			var x1 int
+			if k == -d || (k != d && forward[i-1] < forward[i+1]) {
+				x1 = forward[i+1]
+			} else {
+				x1 = forward[i-1] + 1
+			}
+			y1 := x1 - k
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			forward[i] = x1
+
+			switch {
+			case x1 > n:
+				kEndF += 2
+			case y1 > m:
+				kStartF += 2
+			case front:
+				j := offset + delta - k
+				if j >= 0 && j < size && backward[j] != -1 && x1 >= n-backward[j] {
+					return x1, y1, true
+				}
+			}
+		}
+
+		for k := -d + kStartB; k <= d-kEndB; k += 2 {
+			i := offset + k
+			var x2 int
+			if k == -d || (k != d && backward[i-1] < backward[i+1]) {
+				x2 = backward[i+1]
+			} else {
+				x2 = backward[i-1] + 1
+			}
+			y2 := x2 - k
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2++
+				y2++
+			}
+			backward[i] = x2
+
+			switch {
+			case x2 > n:
+				kEndB += 2
+			case y2 > m:
+				kStartB += 2
+			case !front:
+				j := offset + delta - k
+				if j >= 0 && j < size && forward[j] != -1 {
+					x1 := forward[j]
+					y1 := offset + x1 - j
+					if x1 >= n-x2 {
+						return x1, y1, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,116 @@
+package textdiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Chunk
+	}{
+		{
+			name: "both empty",
+			a:    "",
+			b:    "",
+			want: []Chunk{},
+		},
+		{
+			name: "unchanged",
+			a:    "the quick fox",
+			b:    "the quick fox",
+			want: []Chunk{{OpEqual, "the quick fox"}},
+		},
+		{
+			name: "from nothing",
+			a:    "",
+			b:    "hello world",
+			want: []Chunk{{OpInsert, "hello world"}},
+		},
+		{
+			name: "to nothing",
+			a:    "hello world",
+			b:    "",
+			want: []Chunk{{OpDelete, "hello world"}},
+		},
+		{
+			name: "word replaced",
+			a:    "the quick fox",
+			b:    "the slow fox",
+			want: []Chunk{{OpEqual, "the "}, {OpDelete, "quick"}, {OpInsert, "slow"}, {OpEqual, " fox"}},
+		},
+		{
+			name: "word inserted",
+			a:    "the fox",
+			b:    "the brown fox",
+			want: []Chunk{{OpEqual, "the "}, {OpInsert, "brown "}, {OpEqual, "fox"}},
+		},
+		{
+			name: "word deleted",
+			a:    "the brown fox",
+			b:    "the fox",
+			want: []Chunk{{OpEqual, "the "}, {OpDelete, "brown "}, {OpEqual, "fox"}},
+		},
+		{
+			name: "whitespace changed",
+			a:    "one two",
+			b:    "one\n\ntwo",
+			want: []Chunk{{OpEqual, "one"}, {OpDelete, " "}, {OpInsert, "\n\n"}, {OpEqual, "two"}},
+		},
+		{
+			name: "nothing in common",
+			a:    "alpha beta",
+			b:    "gamma",
+			want: []Chunk{{OpDelete, "alpha beta"}, {OpInsert, "gamma"}},
+		},
+		{
+			name: "edits at both ends",
+			a:    "old start middle old end",
+			b:    "new start middle new end",
+			want: []Chunk{{OpDelete, "old"}, {OpInsert, "new"}, {OpEqual, " start middle "}, {OpDelete, "old"}, {OpInsert, "new"}, {OpEqual, " end"}},
+		},
+		{
+			name: "words moved",
+			a:    "a b c d",
+			b:    "c d a b",
+			want: []Chunk{{OpDelete, "a b "}, {OpEqual, "c d"}, {OpInsert, " a b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Words(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Words(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordsRebuildsBothSides(t *testing.T) {
+	a := strings.Repeat("lorem ipsum dolor sit amet ", 200)
+	b := strings.Repeat("lorem dolor sit amet, consectetur ", 200)
+
+	var gotA, gotB strings.Builder
+	for _, chunk := range Words(a, b) {
+		switch chunk.Op {
+		case OpEqual:
+			gotA.WriteString(chunk.Text)
+			gotB.WriteString(chunk.Text)
+		case OpDelete:
+			gotA.WriteString(chunk.Text)
+		case OpInsert:
+			gotB.WriteString(chunk.Text)
+		}
+	}
+
+	if gotA.String() != a {
+		t.Error("equal and delete chunks don't rebuild a")
+	}
+	if gotB.String() != b {
+		t.Error("equal and insert chunks don't rebuild b")
+	}
+}